@@ -11,6 +11,7 @@ import (
 type ApiServerListener interface {
 	RunService(ctx context.Context, event ServiceStartEvent) (evt ServiceCompleteEvent)
 	RunApi(ctx context.Context, event ApiStartEvent) (evt ApiCompleteEvent)
+	CancelTask(event TaskCancelEvent) error
 }
 
 func NewApiServer(port int64) ApiServer {
@@ -38,6 +39,7 @@ func (s *ApiServerImpl) Start(listener ApiServerListener) {
 	s.ginEngine.GET("/v1/health", s.invokeHealthCheck)
 	s.ginEngine.POST("/v1/invoke/api", s.invokeApiHandler)
 	s.ginEngine.POST("/v1/invoke/service", s.invokeServiceHandler)
+	s.ginEngine.POST("/v1/invoke/cancel", s.invokeCancelHandler)
 
 	go func() {
 		// Start the Gin server
@@ -83,3 +85,24 @@ func (s *ApiServerImpl) invokeServiceHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, output)
 }
+
+func (s *ApiServerImpl) invokeCancelHandler(c *gin.Context) {
+	var input TaskCancelEvent
+
+	fmt.Println("cancel task received")
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fmt.Printf("cancel task failed %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorEvent{Error: ErrorToSdkError(ErrBadRequest.Wrap(err))})
+		return
+	}
+
+	err := s.listener.CancelTask(input)
+	if err != nil {
+		fmt.Printf("cancel task failed %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, ErrorEvent{Error: ErrorToSdkError(err)})
+		return
+	}
+
+	fmt.Println("cancel task success")
+	c.Status(http.StatusOK)
+}
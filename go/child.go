@@ -0,0 +1,38 @@
+package runtime
+
+import (
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+type ChildWorkflow struct {
+	Future
+	taskId string
+}
+
+func (c *ChildWorkflow) TaskId() string {
+	return c.taskId
+}
+
+func (c *ChildWorkflow) Status() (sdk.TaskStatus, error) {
+	res, err := c.serviceClient.GetChildStatus(c.sessionId, ChildRequest{
+		TaskId: c.taskId,
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.Status, nil
+}
+
+func (c *ChildWorkflow) Cancel() error {
+	return c.serviceClient.CancelChild(c.sessionId, ChildRequest{
+		TaskId: c.taskId,
+	})
+}
+
+func (c *ChildWorkflow) Detach() error {
+	return c.serviceClient.DetachChild(c.sessionId, ChildRequest{
+		TaskId: c.taskId,
+	})
+}
+
+var _ sdk.ChildWorkflow = (*ChildWorkflow)(nil)
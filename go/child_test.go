@@ -0,0 +1,103 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+// childStatus reads the status of a task the way the platform reports it
+func childStatus(client *MemoryServiceClient, taskId string) sdk.TaskStatus {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.findTask(taskId).status()
+}
+
+func TestChildWorkflow_ParentAwaitsResult(t *testing.T) {
+	var result int
+	client := newTestClient(t, &testService{
+		name: "orders",
+		workflows: map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error){
+			"Parent": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				child, err := ctx.Service("orders").Get().StartChild(sdk.TaskOptions{}, "Child", testInput{Count: input.Count})
+				if err != nil {
+					return nil, err
+				}
+
+				res, err := child.Await()
+				if err != nil {
+					return nil, err
+				}
+				err = res.Get(&result)
+				return result, err
+			},
+			"Child": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				err := ctx.Sleep(time.Minute)
+				return input.Count * 2, err
+			},
+		},
+	})
+
+	runService(client, "orders", "Parent", testInput{Count: 21})
+	if result != 0 {
+		t.Fatal("parent completed before its child")
+	}
+
+	client.Advance(time.Minute)
+	client.RunPending(context.Background())
+	if result != 42 {
+		t.Fatalf("expected the child result 42, got %d", result)
+	}
+}
+
+func TestChildWorkflow_AttachedChildrenEndWithParent(t *testing.T) {
+	children := make(map[string]string)
+	client := newTestClient(t, &testService{
+		name: "orders",
+		workflows: map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error){
+			"Parent": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				attached, err := ctx.Service("orders").Get().StartChild(sdk.TaskOptions{}, "Child", testInput{})
+				if err != nil {
+					return nil, err
+				}
+				detached, err := ctx.Service("orders").Get().StartChild(sdk.TaskOptions{}, "Child", testInput{})
+				if err != nil {
+					return nil, err
+				}
+				err = detached.Detach()
+				if err != nil {
+					return nil, err
+				}
+
+				status, err := attached.Status()
+				if err != nil {
+					return nil, err
+				} else if status != sdk.TaskStatusRunning {
+					return nil, fmt.Errorf("expected a running child, got %s", status)
+				}
+				children["attached"] = attached.TaskId()
+				children["detached"] = detached.TaskId()
+				return nil, nil
+			},
+			"Child": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				_, err := ctx.Signal("go").Await()
+				return nil, err
+			},
+		},
+	})
+
+	evt := runService(client, "orders", "Parent", testInput{})
+	if evt.IsError {
+		t.Fatalf("parent failed: %s", evt.Error.Error())
+	}
+
+	if status := childStatus(client, children["attached"]); status != sdk.TaskStatusCancelled {
+		t.Fatalf("expected the attached child to be cancelled with its parent, got %s", status)
+	}
+	if status := childStatus(client, children["detached"]); status != sdk.TaskStatusRunning {
+		t.Fatalf("expected the detached child to keep running, got %s", status)
+	}
+}
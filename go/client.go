@@ -3,8 +3,10 @@ package runtime
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/cloudimpl/polycode-runtime/go/sdk"
+	"io"
 	"log"
 	"net/http"
 	"time"
@@ -77,6 +79,40 @@ type ExecAppResponse struct {
 	Error   sdk.Error `json:"error"`
 }
 
+type ExecAsyncResponse struct {
+	CallId string `json:"callId"`
+}
+
+type AwaitCallsRequest struct {
+	CallIds []string `json:"callIds"`
+	Any     bool     `json:"any"`
+}
+
+type AsyncCallResult struct {
+	CallId      string    `json:"callId"`
+	IsCompleted bool      `json:"isCompleted"`
+	Output      any       `json:"output"`
+	IsError     bool      `json:"isError"`
+	Error       sdk.Error `json:"error"`
+}
+
+type AwaitCallsResponse struct {
+	Results []AsyncCallResult `json:"results"`
+}
+
+type StartChildResponse struct {
+	TaskId string `json:"taskId"`
+	CallId string `json:"callId"`
+}
+
+type ChildRequest struct {
+	TaskId string `json:"taskId"`
+}
+
+type ChildStatusResponse struct {
+	Status sdk.TaskStatus `json:"status"`
+}
+
 type ExecFuncRequest struct {
 	Input any `json:"input"`
 }
@@ -101,11 +137,32 @@ type GetDataRequest struct {
 	Path     string        `json:"path"`
 }
 
+type GetManyRequest struct {
+	Items []GetDataRequest `json:"items"`
+}
+
 type GetDataResponse struct {
-	Path    string                 `json:"path"`
-	Exist   bool                   `json:"exist"`
-	Version int64                  `json:"version"`
-	Data    map[string]interface{} `json:"data"`
+	Path          string                 `json:"path"`
+	Exist         bool                   `json:"exist"`
+	Version       int64                  `json:"version"`
+	SchemaVersion int                    `json:"schemaVersion"`
+	CreatedAt     time.Time              `json:"createdAt"`
+	UpdatedAt     time.Time              `json:"updatedAt"`
+	ExpiresAt     time.Time              `json:"expiresAt"`
+	Data          map[string]interface{} `json:"data"`
+}
+
+// GetManyResponse holds one item per requested document, in the order of the request
+type GetManyResponse struct {
+	Items []GetDataResponse `json:"items"`
+}
+
+// WriteDataResponse is the state of a document after a write, ExpiresAt is zero when it has no ttl
+type WriteDataResponse struct {
+	Version   int64     `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
 }
 
 type QueryDataRequest struct {
@@ -114,6 +171,8 @@ type QueryDataRequest struct {
 	CollectionPath string        `json:"collectionPath"`
 	Filter         string        `json:"filter"`
 	Args           []interface{} `json:"args"`
+	OrderBy        []sdk.OrderBy `json:"orderBy"`
+	Select         []string      `json:"select"`
 	OffsetToken    string        `json:"offsetToken"`
 	Limit          int           `json:"limit"`
 }
@@ -123,6 +182,20 @@ type QueryDataResponse struct {
 	NextToken string            `json:"nextToken"`
 }
 
+type AggregateDataRequest struct {
+	Scope          sdk.DataScope   `json:"scope"`
+	TenantId       string          `json:"tenantId"`
+	CollectionPath string          `json:"collectionPath"`
+	Filter         string          `json:"filter"`
+	Args           []interface{}   `json:"args"`
+	GroupBy        []string        `json:"groupBy"`
+	Aggregates     []sdk.Aggregate `json:"aggregates"`
+}
+
+type AggregateDataResponse struct {
+	Groups []sdk.AggregateGroup `json:"groups"`
+}
+
 type InsertDataRequest struct {
 	Scope          sdk.DataScope          `json:"scope"`
 	TenantId       string                 `json:"tenantId"`
@@ -132,15 +205,18 @@ type InsertDataRequest struct {
 	Type           string                 `json:"type"`
 	Id             string                 `json:"id"`
 	Item           map[string]interface{} `json:"item"`
+	SchemaVersion  int                    `json:"schemaVersion"`
 	Cfg            sdk.WriteConfig        `json:"cfg"`
 }
 
+// UpdateDataRequest replaces the item of a document, a zero SchemaVersion keeps the stored one
 type UpdateDataRequest struct {
-	Scope    sdk.DataScope          `json:"scope"`
-	TenantId string                 `json:"tenantId"`
-	Path     string                 `json:"path"`
-	Item     map[string]interface{} `json:"item"`
-	Cfg      sdk.WriteConfig        `json:"cfg"`
+	Scope         sdk.DataScope          `json:"scope"`
+	TenantId      string                 `json:"tenantId"`
+	Path          string                 `json:"path"`
+	Item          map[string]interface{} `json:"item"`
+	SchemaVersion int                    `json:"schemaVersion"`
+	Cfg           sdk.WriteConfig        `json:"cfg"`
 }
 
 type DeleteDataRequest struct {
@@ -157,6 +233,67 @@ type UpdateTTLRequest struct {
 	Cfg      sdk.WriteConfig `json:"cfg"`
 }
 
+// PatchDataRequest applies Ops to the stored document. SchemaVersion is the schema version the
+// operations were validated against, a document stored with an older one is rejected with
+// sdk.ErrStaleSchema so it can be upgraded first. Documents without a schema version count as 1.
+type PatchDataRequest struct {
+	Scope         sdk.DataScope   `json:"scope"`
+	TenantId      string          `json:"tenantId"`
+	Path          string          `json:"path"`
+	Ops           []sdk.PatchOp   `json:"ops"`
+	SchemaVersion int             `json:"schemaVersion"`
+	Cfg           sdk.WriteConfig `json:"cfg"`
+}
+
+type InsertManyRequest struct {
+	Items []InsertDataRequest `json:"items"`
+}
+
+type UpdateManyRequest struct {
+	Scope          sdk.DataScope          `json:"scope"`
+	TenantId       string                 `json:"tenantId"`
+	CollectionPath string                 `json:"collectionPath"`
+	Filter         string                 `json:"filter"`
+	Args           []interface{}          `json:"args"`
+	Patch          map[string]interface{} `json:"patch"`
+	Cfg            sdk.WriteConfig        `json:"cfg"`
+}
+
+type DeleteManyRequest struct {
+	Scope          sdk.DataScope   `json:"scope"`
+	TenantId       string          `json:"tenantId"`
+	CollectionPath string          `json:"collectionPath"`
+	Filter         string          `json:"filter"`
+	Args           []interface{}   `json:"args"`
+	Cfg            sdk.WriteConfig `json:"cfg"`
+}
+
+type BatchWriteResponse struct {
+	Results []sdk.BatchResult `json:"results"`
+}
+
+type TransactionRead struct {
+	Scope    sdk.DataScope `json:"scope"`
+	TenantId string        `json:"tenantId"`
+	Path     string        `json:"path"`
+	Version  int64         `json:"version"`
+}
+
+// TransactionWrite holds exactly one of the write requests
+type TransactionWrite struct {
+	Insert    *InsertDataRequest `json:"insert,omitempty"`
+	Update    *UpdateDataRequest `json:"update,omitempty"`
+	Delete    *DeleteDataRequest `json:"delete,omitempty"`
+	UpdateTTL *UpdateTTLRequest  `json:"updateTTL,omitempty"`
+}
+
+// CommitTransactionRequest applies the writes atomically, provided the documents read
+// still have the recorded versions (0 for documents that did not exist)
+type CommitTransactionRequest struct {
+	Reads  []TransactionRead  `json:"reads"`
+	Writes []TransactionWrite `json:"writes"`
+}
+
 // GetFileRequest represents the JSON structure for get file operations
 type GetFileRequest struct {
 	Scope    sdk.DataScope `json:"scope"`
@@ -246,13 +383,36 @@ type RealtimeEventEmitRequest struct {
 
 type SignalWaitRequest struct {
 	SignalName string `json:"signalName"`
+	Timeout    int64  `json:"timeout"` // milliseconds, 0 waits forever
 }
 
 type SignalWaitResponse struct {
-	IsAsync bool      `json:"isAsync"`
-	Output  any       `json:"output"`
-	IsError bool      `json:"isError"`
-	Error   sdk.Error `json:"error"`
+	IsAsync   bool      `json:"isAsync"`
+	IsTimeout bool      `json:"isTimeout"`
+	Output    any       `json:"output"`
+	IsError   bool      `json:"isError"`
+	Error     sdk.Error `json:"error"`
+}
+
+// SleepRequest carries either a relative Duration or an absolute Until, both in milliseconds
+type SleepRequest struct {
+	Duration int64 `json:"duration"`
+	Until    int64 `json:"until"`
+}
+
+// VersionRequest looks up the marker of ChangeId at the current position of the task journal.
+// A marker that is not journaled yet is recorded with MaxVersion once the task has replayed all
+// of its journal.
+type VersionRequest struct {
+	ChangeId   string `json:"changeId"`
+	MaxVersion int    `json:"maxVersion"`
+}
+
+// VersionResponse holds the version of a marker found in or added to the journal. Recorded is false
+// when the journal goes on with another step, the task then ran past this point before the marker existed.
+type VersionResponse struct {
+	Version  int  `json:"version"`
+	Recorded bool `json:"recorded"`
 }
 
 type AcquireLockRequest struct {
@@ -287,15 +447,29 @@ type ServiceClient interface {
 	CallApi(sessionId string, req ExecApiRequest) (ExecApiResponse, error)
 	CallApp(sessionId string, req ExecAppRequest) (ExecAppResponse, error)
 	SendApp(sessionId string, req ExecAppRequest) error
+	CallServiceAsync(sessionId string, req ExecServiceRequest) (ExecAsyncResponse, error)
+	CallAppAsync(sessionId string, req ExecAppRequest) (ExecAsyncResponse, error)
+	AwaitCalls(sessionId string, req AwaitCallsRequest) (AwaitCallsResponse, error)
+	StartChild(sessionId string, req ExecServiceRequest) (StartChildResponse, error)
+	GetChildStatus(sessionId string, req ChildRequest) (ChildStatusResponse, error)
+	CancelChild(sessionId string, req ChildRequest) error
+	DetachChild(sessionId string, req ChildRequest) error
 	ExecFunc(sessionId string, req ExecFuncRequest) (ExecFuncResponse, error)
 	ExecFuncResult(sessionId string, req ExecFuncResult) error
 
 	GetData(sessionId string, req GetDataRequest) (GetDataResponse, error)
+	GetMany(sessionId string, req GetManyRequest) (GetManyResponse, error)
 	QueryData(sessionId string, req QueryDataRequest) (QueryDataResponse, error)
-	InsertData(sessionId string, req InsertDataRequest) error
-	UpdateData(sessionId string, req UpdateDataRequest) error
+	AggregateData(sessionId string, req AggregateDataRequest) (AggregateDataResponse, error)
+	InsertData(sessionId string, req InsertDataRequest) (WriteDataResponse, error)
+	UpdateData(sessionId string, req UpdateDataRequest) (WriteDataResponse, error)
 	DeleteData(sessionId string, req DeleteDataRequest) error
-	UpdateTTL(sessionId string, req UpdateTTLRequest) error
+	PatchData(sessionId string, req PatchDataRequest) (GetDataResponse, error)
+	UpdateTTL(sessionId string, req UpdateTTLRequest) (WriteDataResponse, error)
+	InsertMany(sessionId string, req InsertManyRequest) (BatchWriteResponse, error)
+	UpdateMany(sessionId string, req UpdateManyRequest) (BatchWriteResponse, error)
+	DeleteMany(sessionId string, req DeleteManyRequest) (BatchWriteResponse, error)
+	CommitTransaction(sessionId string, req CommitTransactionRequest) error
 
 	ReadFileContent(sessionId string, req ReadFileContentRequest) (ReadFileContentResponse, error)
 	GetFile(sessionId string, req GetFileRequest) (GetFileResponse, error)
@@ -311,6 +485,9 @@ type ServiceClient interface {
 	WaitForSignal(sessionId string, req SignalWaitRequest) (SignalWaitResponse, error)
 	EmitRealtimeEvent(sessionId string, req RealtimeEventEmitRequest) error
 
+	Sleep(sessionId string, req SleepRequest) error
+	GetVersion(sessionId string, req VersionRequest) (VersionResponse, error)
+
 	AcquireLock(sessionId string, req AcquireLockRequest) error
 	ReleaseLock(sessionId string, req ReleaseLockRequest) error
 }
@@ -373,6 +550,44 @@ func (sc *ServiceClientImpl) SendApp(sessionId string, req ExecAppRequest) error
 	return executeApiWithoutResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/app/send", req)
 }
 
+func (sc *ServiceClientImpl) CallServiceAsync(sessionId string, req ExecServiceRequest) (ExecAsyncResponse, error) {
+	var res ExecAsyncResponse
+	err := executeApiWithResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/service/call-async", req, &res)
+	return res, err
+}
+
+func (sc *ServiceClientImpl) CallAppAsync(sessionId string, req ExecAppRequest) (ExecAsyncResponse, error) {
+	var res ExecAsyncResponse
+	err := executeApiWithResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/app/call-async", req, &res)
+	return res, err
+}
+
+func (sc *ServiceClientImpl) AwaitCalls(sessionId string, req AwaitCallsRequest) (AwaitCallsResponse, error) {
+	var res AwaitCallsResponse
+	err := executeApiWithResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/call/await", req, &res)
+	return res, err
+}
+
+func (sc *ServiceClientImpl) StartChild(sessionId string, req ExecServiceRequest) (StartChildResponse, error) {
+	var res StartChildResponse
+	err := executeApiWithResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/child/start", req, &res)
+	return res, err
+}
+
+func (sc *ServiceClientImpl) GetChildStatus(sessionId string, req ChildRequest) (ChildStatusResponse, error) {
+	var res ChildStatusResponse
+	err := executeApiWithResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/child/status", req, &res)
+	return res, err
+}
+
+func (sc *ServiceClientImpl) CancelChild(sessionId string, req ChildRequest) error {
+	return executeApiWithoutResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/child/cancel", req)
+}
+
+func (sc *ServiceClientImpl) DetachChild(sessionId string, req ChildRequest) error {
+	return executeApiWithoutResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/child/detach", req)
+}
+
 func (sc *ServiceClientImpl) ExecFunc(sessionId string, req ExecFuncRequest) (ExecFuncResponse, error) {
 	var res ExecFuncResponse
 	err := executeApiWithResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/func/exec", req, &res)
@@ -399,26 +614,66 @@ func (sc *ServiceClientImpl) GetData(sessionId string, req GetDataRequest) (GetD
 	return res, err
 }
 
+func (sc *ServiceClientImpl) GetMany(sessionId string, req GetManyRequest) (GetManyResponse, error) {
+	var res GetManyResponse
+	err := executeApiWithResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/db/get-many", req, &res)
+	return res, err
+}
+
 func (sc *ServiceClientImpl) QueryData(sessionId string, req QueryDataRequest) (QueryDataResponse, error) {
 	var res QueryDataResponse
 	err := executeApiWithResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/db/query", req, &res)
 	return res, err
 }
 
-func (sc *ServiceClientImpl) InsertData(sessionId string, req InsertDataRequest) error {
-	return executeApiWithoutResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/db/insert", req)
+func (sc *ServiceClientImpl) AggregateData(sessionId string, req AggregateDataRequest) (AggregateDataResponse, error) {
+	var res AggregateDataResponse
+	err := executeApiWithResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/db/aggregate", req, &res)
+	return res, err
+}
+
+func (sc *ServiceClientImpl) InsertData(sessionId string, req InsertDataRequest) (WriteDataResponse, error) {
+	return executeWriteApi(sc.httpClient, sc.baseURL, sessionId, "v1/context/db/insert", req)
 }
 
-func (sc *ServiceClientImpl) UpdateData(sessionId string, req UpdateDataRequest) error {
-	return executeApiWithoutResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/db/update", req)
+func (sc *ServiceClientImpl) UpdateData(sessionId string, req UpdateDataRequest) (WriteDataResponse, error) {
+	return executeWriteApi(sc.httpClient, sc.baseURL, sessionId, "v1/context/db/update", req)
 }
 
 func (sc *ServiceClientImpl) DeleteData(sessionId string, req DeleteDataRequest) error {
 	return executeApiWithoutResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/db/delete", req)
 }
 
-func (sc *ServiceClientImpl) UpdateTTL(sessionId string, req UpdateTTLRequest) error {
-	return executeApiWithoutResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/db/update-ttl", req)
+func (sc *ServiceClientImpl) PatchData(sessionId string, req PatchDataRequest) (GetDataResponse, error) {
+	var res GetDataResponse
+	err := executeApiWithResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/db/patch", req, &res)
+	return res, err
+}
+
+func (sc *ServiceClientImpl) InsertMany(sessionId string, req InsertManyRequest) (BatchWriteResponse, error) {
+	var res BatchWriteResponse
+	err := executeApiWithResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/db/insert-many", req, &res)
+	return res, err
+}
+
+func (sc *ServiceClientImpl) UpdateMany(sessionId string, req UpdateManyRequest) (BatchWriteResponse, error) {
+	var res BatchWriteResponse
+	err := executeApiWithResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/db/update-many", req, &res)
+	return res, err
+}
+
+func (sc *ServiceClientImpl) DeleteMany(sessionId string, req DeleteManyRequest) (BatchWriteResponse, error) {
+	var res BatchWriteResponse
+	err := executeApiWithResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/db/delete-many", req, &res)
+	return res, err
+}
+
+func (sc *ServiceClientImpl) CommitTransaction(sessionId string, req CommitTransactionRequest) error {
+	return executeApiWithoutResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/db/transaction", req)
+}
+
+func (sc *ServiceClientImpl) UpdateTTL(sessionId string, req UpdateTTLRequest) (WriteDataResponse, error) {
+	return executeWriteApi(sc.httpClient, sc.baseURL, sessionId, "v1/context/db/update-ttl", req)
 }
 
 func (sc *ServiceClientImpl) ReadFileContent(sessionId string, req ReadFileContentRequest) (ReadFileContentResponse, error) {
@@ -481,6 +736,16 @@ func (sc *ServiceClientImpl) EmitRealtimeEvent(sessionId string, req RealtimeEve
 	return executeApiWithoutResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/realtime/event/emit", req)
 }
 
+func (sc *ServiceClientImpl) Sleep(sessionId string, req SleepRequest) error {
+	return executeApiWithoutResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/timer/sleep", req)
+}
+
+func (sc *ServiceClientImpl) GetVersion(sessionId string, req VersionRequest) (VersionResponse, error) {
+	res := VersionResponse{}
+	err := executeApiWithResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/version/get", req, &res)
+	return res, err
+}
+
 func (sc *ServiceClientImpl) AcquireLock(sessionId string, req AcquireLockRequest) error {
 	return executeApiWithoutResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/lock/acquire", req)
 }
@@ -489,6 +754,17 @@ func (sc *ServiceClientImpl) ReleaseLock(sessionId string, req ReleaseLockReques
 	return executeApiWithoutResponse(sc.httpClient, sc.baseURL, sessionId, "v1/context/lock/release", req)
 }
 
+// executeWriteApi runs a document write. Sidecars that predate WriteDataResponse answer with
+// an empty body, which is read as a zero response so the doc keeps the version it had.
+func executeWriteApi(httpClient *http.Client, baseUrl string, sessionId string, path string, req any) (WriteDataResponse, error) {
+	var res WriteDataResponse
+	err := executeApiWithResponse(httpClient, baseUrl, sessionId, path, req, &res)
+	if errors.Is(err, io.EOF) {
+		return WriteDataResponse{}, nil
+	}
+	return res, err
+}
+
 func executeApiWithoutResponse(httpClient *http.Client, baseUrl string, sessionId string, path string, req any) error {
 	log.Printf("client: exec api without response from %s with session id %s", path, sessionId)
 
@@ -1,127 +1,195 @@
 package runtime
 
-//import (
-//	"fmt"
-//	"github.com/cloudimpl/polycode-runtime-go/sdk"
-//	"github.com/gin-gonic/gin"
-//	"net/http"
-//	"time"
-//)
-//
-//func startMockBackendServer(port int) {
-//	router := gin.Default()
-//
-//	// Health check
-//	router.GET("/v1/health", func(c *gin.Context) {
-//		c.JSON(http.StatusOK, gin.H{"status": "ok"})
-//	})
-//
-//	// --- App & Service Execution ---
-//	router.POST("/v1/system/app/start", empty200)
-//	router.POST("/v1/context/service/exec", func(c *gin.Context) {
-//		c.JSON(200, ExecServiceResponse{
-//			Output: map[string]any{"service": "ok"},
-//		})
-//	})
-//	router.POST("/v1/context/api/exec", func(c *gin.Context) {
-//		c.JSON(200, ExecApiResponse{
-//			Response: sdk.ApiResponse{
-//				StatusCode: 200,
-//				Header:     map[string]string{"X-Mock": "true"},
-//				Body:       `{"result":"api-ok"}`,
-//			},
-//		})
-//	})
-//	router.POST("/v1/context/func/exec", func(c *gin.Context) {
-//		c.JSON(200, ExecFuncResponse{
-//			Output: "func-output",
-//		})
-//	})
-//	router.POST("/v1/context/func/exec/result", empty200)
-//
-//	// --- DB ---
-//	router.POST("/v1/context/db/get", mockJSON)
-//	router.POST("/v1/context/db/unsafe-get", mockJSON)
-//	router.POST("/v1/context/db/query", func(c *gin.Context) {
-//		c.JSON(200, []map[string]any{{"key": "val"}})
-//	})
-//	router.POST("/v1/context/db/unsafe-query", func(c *gin.Context) {
-//		c.JSON(200, []map[string]any{{"key": "unsafe"}})
-//	})
-//	router.POST("/v1/context/db/put", empty200)
-//	router.POST("/v1/context/db/unsafe-put", empty200)
-//
-//	// --- File ---
-//	router.POST("/v1/context/file/get", func(c *gin.Context) {
-//		c.JSON(200, GetFileResponse{Content: "mock-content"})
-//	})
-//	router.POST("/v1/context/file/get-download-link", func(c *gin.Context) {
-//		c.JSON(200, GetLinkResponse{Link: "http://mock.link/download"})
-//	})
-//	router.POST("/v1/context/file/put", empty200)
-//	router.POST("/v1/context/file/get-upload-link", func(c *gin.Context) {
-//		c.JSON(200, GetLinkResponse{Link: "http://mock.link/upload"})
-//	})
-//	router.POST("/v1/context/file/delete", empty200)
-//	router.POST("/v1/context/file/rename", empty200)
-//	router.POST("/v1/context/file/list", func(c *gin.Context) {
-//		c.JSON(200, ListFolderResponse{
-//			Files: []ListFileResponse{{
-//				Key:          "file1.txt",
-//				Size:         123,
-//				LastModified: time.Now(),
-//			}},
-//			IsTruncated:           false,
-//			NextContinuationToken: nil,
-//		})
-//	})
-//	router.POST("/v1/context/file/create-folder", empty200)
-//
-//	// --- Signal & Event ---
-//	router.POST("/v1/context/signal/emit", empty200)
-//	router.POST("/v1/context/signal/await", func(c *gin.Context) {
-//		c.JSON(200, SignalWaitResponse{
-//			IsAsync: false,
-//			Output:  "signal-output",
-//		})
-//	})
-//	router.POST("/v1/context/realtime/event/emit", empty200)
-//
-//	// --- Lock ---
-//	router.POST("/v1/context/lock/acquire", empty200)
-//	router.POST("/v1/context/lock/release", empty200)
-//
-//	// --- Meta & Counter ---
-//	router.POST("/v1/elevated/context/counter/increment", func(c *gin.Context) {
-//		c.JSON(200, IncrementCounterResponse{
-//			Value:       42,
-//			Incremented: true,
-//		})
-//	})
-//	router.POST("/v1/elevated/context/meta/get", func(c *gin.Context) {
-//		c.JSON(200, map[string]interface{}{"meta": "value"})
-//	})
-//
-//	// --- Misc ---
-//	router.POST("/v1/context/acknowledge", empty200)
-//
-//	router.Run(getAddr(port))
-//}
-//
-//func getAddr(port int) string {
-//	if port == 0 {
-//		port = 8080
-//	}
-//	return ":" + fmt.Sprint(port)
-//}
-//
-//func empty200(c *gin.Context) {
-//	c.Status(http.StatusOK)
-//}
-//
-//func mockJSON(c *gin.Context) {
-//	c.JSON(200, map[string]interface{}{
-//		"key":   "value",
-//		"value": 123,
-//	})
-//}
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+// serveMemory answers a sidecar endpoint with fn of a memory client, the way the sidecar does
+func serveMemory[Req any, Res any](fn func(sessionId string, req Req) (Res, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(ErrorEvent{Error: ErrorToSdkError(ErrBadRequest.Wrap(err))})
+			return
+		}
+
+		res, err := fn(r.Header.Get(SessionIdHeader), req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(ErrorEvent{Error: ErrorToSdkError(err)})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}
+}
+
+func serveMemoryWithoutResponse[Req any](fn func(sessionId string, req Req) error) http.HandlerFunc {
+	return serveMemory(func(sessionId string, req Req) (struct{}, error) {
+		return struct{}{}, fn(sessionId, req)
+	})
+}
+
+func startMockSidecar(t *testing.T, memory *MemoryServiceClient) ServiceClient {
+	// the app is started so the memory client accepts writes
+	err := memory.StartApp(StartAppRequest{AppName: "test"})
+	if err != nil {
+		t.Fatalf("failed to start app: %s", err.Error())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/context/db/get", serveMemory(memory.GetData))
+	mux.HandleFunc("/v1/context/db/query", serveMemory(memory.QueryData))
+	mux.HandleFunc("/v1/context/db/insert", serveMemory(memory.InsertData))
+	mux.HandleFunc("/v1/context/db/delete", serveMemoryWithoutResponse(memory.DeleteData))
+	mux.HandleFunc("/v1/context/lock/acquire", serveMemoryWithoutResponse(memory.AcquireLock))
+	mux.HandleFunc("/v1/context/timer/sleep", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return NewServiceClient(server.URL)
+}
+
+func TestServiceClient_DataRoundTrip(t *testing.T) {
+	client := startMockSidecar(t, NewMemoryServiceClient())
+
+	_, err := client.InsertData("sess-1", InsertDataRequest{
+		Scope:          sdk.DataScopeApp,
+		TenantId:       "tenant-a",
+		Path:           "items/a",
+		CollectionPath: "items",
+		Item:           map[string]interface{}{"name": "a", "count": 2},
+	})
+	if err != nil {
+		t.Fatalf("insert failed: %s", err.Error())
+	}
+
+	data, err := client.GetData("sess-1", GetDataRequest{
+		Scope:    sdk.DataScopeApp,
+		TenantId: "tenant-a",
+		Path:     "items/a",
+	})
+	if err != nil {
+		t.Fatalf("get failed: %s", err.Error())
+	}
+	if !data.Exist || data.Version != 1 || data.Data["name"] != "a" {
+		t.Fatalf("unexpected document %+v", data)
+	}
+
+	res, err := client.QueryData("sess-1", QueryDataRequest{
+		Scope:          sdk.DataScopeApp,
+		TenantId:       "tenant-a",
+		CollectionPath: "items",
+		Filter:         "count = ?",
+		Args:           []interface{}{2},
+	})
+	if err != nil {
+		t.Fatalf("query failed: %s", err.Error())
+	}
+	if len(res.Data) != 1 || res.Data[0].Path != "items/a" {
+		t.Fatalf("unexpected query result %+v", res.Data)
+	}
+
+	err = client.DeleteData("sess-1", DeleteDataRequest{
+		Scope:    sdk.DataScopeApp,
+		TenantId: "tenant-a",
+		Path:     "items/a",
+	})
+	if err != nil {
+		t.Fatalf("delete failed: %s", err.Error())
+	}
+}
+
+func TestServiceClient_ErrorResponse(t *testing.T) {
+	client := startMockSidecar(t, NewMemoryServiceClient())
+
+	_, err := client.InsertData("sess-1", InsertDataRequest{
+		Scope: sdk.DataScopeApp,
+		Path:  "items/a",
+		Item:  map[string]interface{}{},
+	})
+	if err != nil {
+		t.Fatalf("insert failed: %s", err.Error())
+	}
+
+	_, err = client.InsertData("sess-1", InsertDataRequest{
+		Scope: sdk.DataScopeApp,
+		Path:  "items/a",
+		Item:  map[string]interface{}{},
+	})
+	if !sdk.IsError(err, sdk.ErrAlreadyExist) {
+		t.Fatalf("expected already exist, got %v", err)
+	}
+
+	ttl := time.Now().Add(time.Minute).Unix()
+	err = client.AcquireLock("sess-1", AcquireLockRequest{Key: "k", TTL: ttl})
+	if err != nil {
+		t.Fatalf("acquire failed: %s", err.Error())
+	}
+	err = client.AcquireLock("sess-2", AcquireLockRequest{Key: "k", TTL: ttl})
+	if !sdk.IsError(err, sdk.ErrConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+}
+
+func TestServiceClient_AcceptedHaltsTask(t *testing.T) {
+	client := startMockSidecar(t, NewMemoryServiceClient())
+
+	halted := func() (r any) {
+		defer func() {
+			r = recover()
+		}()
+
+		_ = client.Sleep("sess-1", SleepRequest{Until: time.Now().Add(time.Second).UnixMilli()})
+		return nil
+	}()
+	if halted != any(HaltExecution) {
+		t.Fatalf("expected the task to halt, got %v", halted)
+	}
+}
+
+func TestServiceClient_EmptyWriteResponse(t *testing.T) {
+	// sidecars that predate WriteDataResponse answer writes with an empty body
+	mux := http.NewServeMux()
+	for _, path := range []string{"insert", "update", "update-ttl"} {
+		mux.HandleFunc("/v1/context/db/"+path, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+	}
+	mux.HandleFunc("/v1/context/db/get", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := NewServiceClient(server.URL)
+
+	res, err := client.InsertData("sess-1", InsertDataRequest{Scope: sdk.DataScopeApp, Path: "items/a"})
+	if err != nil || res.Version != 0 {
+		t.Fatalf("expected an empty insert response, got %+v %v", res, err)
+	}
+	res, err = client.UpdateData("sess-1", UpdateDataRequest{Scope: sdk.DataScopeApp, Path: "items/a"})
+	if err != nil || res.Version != 0 {
+		t.Fatalf("expected an empty update response, got %+v %v", res, err)
+	}
+	res, err = client.UpdateTTL("sess-1", UpdateTTLRequest{Scope: sdk.DataScopeApp, Path: "items/a"})
+	if err != nil || res.Version != 0 {
+		t.Fatalf("expected an empty ttl response, got %+v %v", res, err)
+	}
+
+	// reads still need a body
+	_, err = client.GetData("sess-1", GetDataRequest{Scope: sdk.DataScopeApp, Path: "items/a"})
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("expected an empty read response to fail with EOF, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	runtime "github.com/cloudimpl/polycode-runtime/go"
+	"net/http"
+)
+
+// appListener runs tasks by invoking the registered app over http
+type appListener struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+func (l *appListener) RunService(ctx context.Context, event runtime.ServiceStartEvent) runtime.ServiceCompleteEvent {
+	var res runtime.ServiceCompleteEvent
+	err := l.invoke(ctx, "v1/invoke/service", event, &res)
+	if err != nil {
+		return runtime.ErrorToServiceComplete(runtime.ErrServiceExecError.Wrap(err), "")
+	}
+	return res
+}
+
+func (l *appListener) RunApi(ctx context.Context, event runtime.ApiStartEvent) runtime.ApiCompleteEvent {
+	var res runtime.ApiCompleteEvent
+	err := l.invoke(ctx, "v1/invoke/api", event, &res)
+	if err != nil {
+		return runtime.ErrorToApiComplete(runtime.ErrApiExecError.Wrap(err))
+	}
+	return res
+}
+
+func (l *appListener) CancelTask(event runtime.TaskCancelEvent) error {
+	return l.invoke(context.Background(), "v1/invoke/cancel", event, nil)
+}
+
+func (l *appListener) invoke(ctx context.Context, path string, req any, res any) error {
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/%s", l.endpoint, path), bytes.NewBuffer(reqBody))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := l.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("app returned status %d", resp.StatusCode)
+	}
+	if res == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
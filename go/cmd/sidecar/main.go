@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	runtime "github.com/cloudimpl/polycode-runtime/go"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"time"
+)
+
+// sidecar is a local emulator of the polycode sidecar. It serves the endpoints the
+// go client calls, keeps all state in a MemoryServiceClient and persists it to disk.
+type sidecar struct {
+	ctx       context.Context
+	client    *runtime.MemoryServiceClient
+	statePath string
+}
+
+func main() {
+	port := flag.Int("port", 9999, "port to listen on, matching polycode_SIDECAR_API")
+	statePath := flag.String("state", ".polycode/sidecar.json", "file used to persist sidecar state")
+	flag.Parse()
+
+	client := runtime.NewMemoryServiceClient()
+	err := client.Load(*statePath)
+	if err != nil {
+		log.Fatalf("sidecar: %s", err.Error())
+	}
+
+	s := &sidecar{
+		ctx:       context.Background(),
+		client:    client,
+		statePath: *statePath,
+	}
+
+	go s.resumeTasks()
+
+	log.Printf("sidecar: listening on port %d, state file %s", *port, *statePath)
+	err = s.engine().Run(fmt.Sprintf("0.0.0.0:%d", *port))
+	if err != nil {
+		log.Fatalf("sidecar: failed to start server: %s", err.Error())
+	}
+}
+
+// engine serves the sidecar endpoints, saving the state after every request
+func (s *sidecar) engine() *gin.Engine {
+	engine := gin.Default()
+	engine.Use(s.persist)
+	s.registerRoutes(engine)
+	return engine
+}
+
+func (s *sidecar) registerRoutes(engine *gin.Engine) {
+	c := s.client
+
+	engine.GET("/v1/health", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	engine.POST("/v1/system/app/start", s.startApp)
+	engine.POST("/v1/invoke/service", s.invokeService)
+	engine.POST("/v1/invoke/api", s.invokeApi)
+	engine.POST("/v1/invoke/cancel", s.cancelTask)
+
+	engine.POST("/v1/context/service/call", handle(c.CallService))
+	engine.POST("/v1/context/service/send", handleWithoutResponse(c.SendService))
+	engine.POST("/v1/context/agent/call", handle(c.CallAgent))
+	engine.POST("/v1/context/api/call", handle(c.CallApi))
+	engine.POST("/v1/context/app/call", handle(c.CallApp))
+	engine.POST("/v1/context/app/send", handleWithoutResponse(c.SendApp))
+	engine.POST("/v1/context/service/call-async", handle(c.CallServiceAsync))
+	engine.POST("/v1/context/app/call-async", handle(c.CallAppAsync))
+	engine.POST("/v1/context/call/await", handle(c.AwaitCalls))
+	engine.POST("/v1/context/child/start", handle(c.StartChild))
+	engine.POST("/v1/context/child/status", handle(c.GetChildStatus))
+	engine.POST("/v1/context/child/cancel", handleWithoutResponse(c.CancelChild))
+	engine.POST("/v1/context/child/detach", handleWithoutResponse(c.DetachChild))
+	engine.POST("/v1/context/func/exec", handle(c.ExecFunc))
+	engine.POST("/v1/context/func/result", handleWithoutResponse(c.ExecFuncResult))
+
+	engine.POST("/v1/context/db/get", handle(c.GetData))
+	engine.POST("/v1/context/db/get-many", handle(c.GetMany))
+	engine.POST("/v1/context/db/query", handle(c.QueryData))
+	engine.POST("/v1/context/db/aggregate", handle(c.AggregateData))
+	engine.POST("/v1/context/db/insert", handle(c.InsertData))
+	engine.POST("/v1/context/db/update", handle(c.UpdateData))
+	engine.POST("/v1/context/db/delete", handleWithoutResponse(c.DeleteData))
+	engine.POST("/v1/context/db/update-ttl", handle(c.UpdateTTL))
+	engine.POST("/v1/context/db/patch", handle(c.PatchData))
+	engine.POST("/v1/context/db/insert-many", handle(c.InsertMany))
+	engine.POST("/v1/context/db/update-many", handle(c.UpdateMany))
+	engine.POST("/v1/context/db/delete-many", handle(c.DeleteMany))
+	engine.POST("/v1/context/db/transaction", handleWithoutResponse(c.CommitTransaction))
+
+	engine.POST("/v1/context/file/read", handle(c.ReadFileContent))
+	engine.POST("/v1/context/file/get", handle(c.GetFile))
+	engine.POST("/v1/context/file/get-download-link", handle(c.GetFileDownloadLink))
+	engine.POST("/v1/context/file/put", handleWithoutResponse(c.PutFile))
+	engine.POST("/v1/context/file/get-upload-link", handle(c.GetFileUploadLink))
+	engine.POST("/v1/context/file/delete", handleWithoutResponse(c.DeleteFile))
+	engine.POST("/v1/context/file/rename", handleWithoutResponse(c.RenameFile))
+	engine.POST("/v1/context/file/list", handle(c.ListFolder))
+	engine.POST("/v1/context/file/create-folder", handleWithoutResponse(c.CreateFolder))
+
+	engine.POST("/v1/context/signal/emit", handleWithoutResponse(c.EmitSignal))
+	engine.POST("/v1/context/signal/await", handle(c.WaitForSignal))
+	engine.POST("/v1/context/realtime/event/emit", handleWithoutResponse(c.EmitRealtimeEvent))
+
+	engine.POST("/v1/context/timer/sleep", handleWithoutResponse(c.Sleep))
+	engine.POST("/v1/context/version/get", handle(c.GetVersion))
+
+	engine.POST("/v1/context/lock/acquire", handleWithoutResponse(c.AcquireLock))
+	engine.POST("/v1/context/lock/release", handleWithoutResponse(c.ReleaseLock))
+}
+
+// persist saves the sidecar state once a request has been handled
+func (s *sidecar) persist(ctx *gin.Context) {
+	ctx.Next()
+
+	if ctx.Request.Method != http.MethodPost {
+		return
+	}
+
+	err := s.client.Save(s.statePath)
+	if err != nil {
+		log.Printf("sidecar: failed to save state: %s", err.Error())
+	}
+}
+
+// resumeTasks periodically replays tasks whose signal or timer deadline has passed,
+// until the sidecar context is done
+func (s *sidecar) resumeTasks() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.client.RunPending(s.ctx)
+
+		err := s.client.Save(s.statePath)
+		if err != nil {
+			log.Printf("sidecar: failed to save state: %s", err.Error())
+		}
+	}
+}
+
+func (s *sidecar) startApp(ctx *gin.Context) {
+	var req runtime.StartAppRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		writeError(ctx, runtime.ErrBadRequest.Wrap(err))
+		return
+	}
+
+	err := s.client.StartApp(req)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	log.Printf("sidecar: app %s registered at %s", req.AppName, req.AppEndpoint)
+	s.client.Attach(&appListener{
+		endpoint:   req.AppEndpoint,
+		httpClient: &http.Client{},
+	})
+	ctx.Status(http.StatusOK)
+}
+
+func (s *sidecar) invokeService(ctx *gin.Context) {
+	var event runtime.ServiceStartEvent
+	if err := ctx.ShouldBindJSON(&event); err != nil {
+		ctx.JSON(http.StatusOK, runtime.ErrorToServiceComplete(runtime.ErrBadRequest.Wrap(err), ""))
+		return
+	}
+
+	// tasks run on the sidecar context, a caller that goes away must not stop the
+	// pending tasks that are resumed along with this one
+	ctx.JSON(http.StatusOK, s.client.RunService(s.ctx, event))
+}
+
+func (s *sidecar) invokeApi(ctx *gin.Context) {
+	var event runtime.ApiStartEvent
+	if err := ctx.ShouldBindJSON(&event); err != nil {
+		ctx.JSON(http.StatusOK, runtime.ErrorToApiComplete(runtime.ErrBadRequest.Wrap(err)))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, s.client.RunApi(s.ctx, event))
+}
+
+// cancelTask cancels a task. A task running in the app has its context cancelled in flight,
+// a halted one is replayed with a cancelled context on the next resume.
+func (s *sidecar) cancelTask(ctx *gin.Context) {
+	var req runtime.TaskCancelEvent
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		writeError(ctx, runtime.ErrBadRequest.Wrap(err))
+		return
+	}
+
+	err := s.client.CancelTask(req)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+func handle[Req any, Res any](fn func(sessionId string, req Req) (Res, error)) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer recoverHalt(ctx)
+
+		var req Req
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			writeError(ctx, runtime.ErrBadRequest.Wrap(err))
+			return
+		}
+
+		res, err := fn(ctx.GetHeader(runtime.SessionIdHeader), req)
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, res)
+	}
+}
+
+func handleWithoutResponse[Req any](fn func(sessionId string, req Req) error) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer recoverHalt(ctx)
+
+		var req Req
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			writeError(ctx, runtime.ErrBadRequest.Wrap(err))
+			return
+		}
+
+		err := fn(ctx.GetHeader(runtime.SessionIdHeader), req)
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{})
+	}
+}
+
+// recoverHalt turns a halted task into the 202 the client expects when a task is paused
+func recoverHalt(ctx *gin.Context) {
+	if r := recover(); r != nil {
+		if r != any(runtime.HaltExecution) {
+			panic(r)
+		}
+		ctx.Status(http.StatusAccepted)
+	}
+}
+
+func writeError(ctx *gin.Context, err error) {
+	ctx.JSON(http.StatusBadRequest, runtime.ErrorEvent{
+		Error: runtime.ErrorToSdkError(err),
+	})
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	runtime "github.com/cloudimpl/polycode-runtime/go"
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+	"github.com/gin-gonic/gin"
+)
+
+// testService is a ClientService running workflows that take no input
+type testService struct {
+	name      string
+	workflows map[string]func(ctx sdk.WorkflowContext) (any, error)
+}
+
+func (s *testService) GetName() string {
+	return s.name
+}
+
+func (s *testService) GetDescription(method string) (string, error) {
+	return method, nil
+}
+
+func (s *testService) GetInputType(method string) (any, error) {
+	return &map[string]interface{}{}, nil
+}
+
+func (s *testService) GetOutputType(method string) (any, error) {
+	return nil, nil
+}
+
+func (s *testService) IsWorkflow(method string) bool {
+	return true
+}
+
+func (s *testService) ExecuteService(ctx sdk.ServiceContext, method string, input any) (any, error) {
+	return nil, errors.New("unknown method " + method)
+}
+
+func (s *testService) ExecuteWorkflow(ctx sdk.WorkflowContext, method string, input any) (any, error) {
+	workflow, ok := s.workflows[method]
+	if !ok {
+		return nil, errors.New("unknown method " + method)
+	}
+	return workflow(ctx)
+}
+
+// startTestSidecar serves a sidecar keeping its state in a temporary file and resumes its tasks
+// until the test ends
+func startTestSidecar(t *testing.T) (*sidecar, string) {
+	gin.SetMode(gin.TestMode)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &sidecar{
+		ctx:       ctx,
+		client:    runtime.NewMemoryServiceClient(),
+		statePath: filepath.Join(t.TempDir(), "sidecar.json"),
+	}
+	go s.resumeTasks()
+
+	server := httptest.NewServer(s.engine())
+	t.Cleanup(func() {
+		cancel()
+		server.Close()
+	})
+	return s, server.URL
+}
+
+// startTestApp runs the services in an app served over http and registers it with the sidecar
+func startTestApp(t *testing.T, sidecarUrl string, services ...runtime.ClientService) {
+	for _, service := range services {
+		err := runtime.RegisterService(service)
+		if err != nil {
+			t.Fatalf("failed to register service %s: %s", service.GetName(), err.Error())
+		}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %s", err.Error())
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	runtime.NewApiServer(int64(port)).Start(runtime.NewClientRuntime(runtime.NewServiceClient(sidecarUrl)))
+
+	appUrl := fmt.Sprintf("http://127.0.0.1:%d", port)
+	for i := 0; ; i++ {
+		resp, err := http.Get(appUrl + "/v1/health")
+		if err == nil {
+			resp.Body.Close()
+			break
+		} else if i == 50 {
+			t.Fatalf("app failed to start on port %d", port)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	post(t, sidecarUrl+"/v1/system/app/start", runtime.StartAppRequest{
+		AppName:     "test",
+		AppEndpoint: appUrl,
+	}, nil)
+}
+
+func post(t *testing.T, url string, body any, ret any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Errorf("failed to marshal request: %s", err.Error())
+		return
+	}
+
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Errorf("request to %s failed: %s", url, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status %d from %s: %s", resp.StatusCode, url, respBody)
+		return
+	}
+
+	if ret != nil {
+		err = json.Unmarshal(respBody, ret)
+		if err != nil {
+			t.Errorf("failed to decode response %s: %s", respBody, err.Error())
+		}
+	}
+}
+
+// loadState reads the state file of the sidecar into a new client
+func loadState(t *testing.T, s *sidecar) *runtime.MemoryServiceClient {
+	client := runtime.NewMemoryServiceClient()
+	err := client.Load(s.statePath)
+	if err != nil {
+		t.Fatalf("failed to load state: %s", err.Error())
+	}
+	return client
+}
+
+func TestSidecar_StateSurvivesRestart(t *testing.T) {
+	s, url := startTestSidecar(t)
+	post(t, url+"/v1/system/app/start", runtime.StartAppRequest{AppName: "test"}, nil)
+
+	post(t, url+"/v1/context/db/insert", runtime.InsertDataRequest{
+		Scope:          sdk.DataScopeApp,
+		Path:           "items/a",
+		CollectionPath: "items",
+		Item:           map[string]interface{}{"name": "a"},
+	}, nil)
+
+	data, err := loadState(t, s).GetData("", runtime.GetDataRequest{Scope: sdk.DataScopeApp, Path: "items/a"})
+	if err != nil || !data.Exist || data.Data["name"] != "a" {
+		t.Fatalf("document not restored: %+v %v", data, err)
+	}
+}
+
+func TestSidecar_ConcurrentRequestsKeepStateIntact(t *testing.T) {
+	s, url := startTestSidecar(t)
+	post(t, url+"/v1/system/app/start", runtime.StartAppRequest{AppName: "test"}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			post(t, url+"/v1/context/db/insert", runtime.InsertDataRequest{
+				Scope:          sdk.DataScopeApp,
+				Path:           fmt.Sprintf("items/%d", i),
+				CollectionPath: "items",
+				Item:           map[string]interface{}{"payload": strings.Repeat("x", 64*1024)},
+			}, nil)
+		}(i)
+	}
+	wg.Wait()
+
+	res, err := loadState(t, s).QueryData("", runtime.QueryDataRequest{Scope: sdk.DataScopeApp, CollectionPath: "items"})
+	if err != nil || len(res.Data) != 20 {
+		t.Fatalf("expected the last save to hold 20 documents, got %d %v", len(res.Data), err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(s.statePath))
+	if len(entries) != 1 {
+		t.Fatalf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestSidecar_ResumesDueTasks(t *testing.T) {
+	s, url := startTestSidecar(t)
+	startTestApp(t, url, &testService{
+		name: "timers",
+		workflows: map[string]func(ctx sdk.WorkflowContext) (any, error){
+			"Wait": func(ctx sdk.WorkflowContext) (any, error) {
+				err := ctx.Sleep(100 * time.Millisecond)
+				return "woke", err
+			},
+		},
+	})
+
+	var evt runtime.ServiceCompleteEvent
+	post(t, url+"/v1/invoke/service", runtime.ServiceStartEvent{
+		SessionId: "timer-1",
+		Service:   "timers",
+		Method:    "Wait",
+		Input:     map[string]interface{}{},
+	}, &evt)
+	if _, ok := s.client.TaskResult("timer-1"); ok || evt.IsError {
+		t.Fatalf("expected the task to halt on its timer, got %+v", evt)
+	}
+
+	// nothing calls the sidecar, the task is resumed by the ticker which saves its completion
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if evt, ok := loadState(t, s).TaskResult("timer-1"); ok {
+			if evt.IsError || evt.Output != "woke" {
+				t.Fatalf("unexpected completion %+v", evt)
+			}
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("task was not resumed after its timer expired")
+}
+
+func TestSidecar_CancelsRunningTasksInFlight(t *testing.T) {
+	started := make(chan string)
+	_, url := startTestSidecar(t)
+	startTestApp(t, url, &testService{
+		name: "jobs",
+		workflows: map[string]func(ctx sdk.WorkflowContext) (any, error){
+			"Run": func(ctx sdk.WorkflowContext) (any, error) {
+				started <- ctx.Meta().TaskId
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(5 * time.Second):
+					return "not cancelled", nil
+				}
+			},
+		},
+	})
+
+	result := make(chan runtime.ServiceCompleteEvent)
+	go func() {
+		var evt runtime.ServiceCompleteEvent
+		post(t, url+"/v1/invoke/service", runtime.ServiceStartEvent{
+			SessionId: "job-1",
+			Service:   "jobs",
+			Method:    "Run",
+			Input:     map[string]interface{}{},
+		}, &evt)
+		result <- evt
+	}()
+
+	post(t, url+"/v1/invoke/cancel", runtime.TaskCancelEvent{TaskId: <-started}, nil)
+	if evt := <-result; !evt.IsCancelled {
+		t.Fatalf("expected the task to be cancelled in flight, got %+v", evt)
+	}
+}
+
+func TestSidecar_CancelsHaltedTasksOnResume(t *testing.T) {
+	s, url := startTestSidecar(t)
+	startTestApp(t, url, &testService{
+		name: "waiters",
+		workflows: map[string]func(ctx sdk.WorkflowContext) (any, error){
+			"Wait": func(ctx sdk.WorkflowContext) (any, error) {
+				return ctx.Signal("go").Await()
+			},
+		},
+	})
+
+	post(t, url+"/v1/invoke/service", runtime.ServiceStartEvent{
+		SessionId: "waiter-1",
+		Service:   "waiters",
+		Method:    "Wait",
+		Input:     map[string]interface{}{},
+	}, nil)
+	post(t, url+"/v1/invoke/cancel", runtime.TaskCancelEvent{TaskId: "waiter-1"}, nil)
+
+	// the halted task is replayed with a cancelled context by the ticker
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if evt, ok := loadState(t, s).TaskResult("waiter-1"); ok {
+			if !evt.IsCancelled {
+				t.Fatalf("expected the task to complete as cancelled, got %+v", evt)
+			}
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("cancelled task was not resumed")
+}
@@ -2,6 +2,7 @@ package runtime
 
 import (
 	"context"
+	"errors"
 	"github.com/cloudimpl/polycode-runtime/go/sdk"
 	"time"
 )
@@ -13,6 +14,20 @@ type Context struct {
 	modelRegistry *ModelRegistry
 	meta          sdk.TaskMeta
 	validator     sdk.Validator
+	saga          *saga
+}
+
+// NewContext creates a task context for a session, bound to the models registered for the service.
+func NewContext(ctx context.Context, client ServiceClient, sessionId string, serviceName string, meta sdk.TaskMeta) *Context {
+	return &Context{
+		ctx:           ctx,
+		sessionId:     sessionId,
+		client:        client,
+		modelRegistry: GetModelRegistry(serviceName),
+		meta:          meta,
+		validator:     DummyValidator{},
+		saga:          &saga{},
+	}
 }
 
 func (c Context) Deadline() (deadline time.Time, ok bool) {
@@ -120,9 +135,67 @@ func (c Context) Memo(getter func() (any, error)) sdk.Response {
 	}.Get()
 }
 
+func (c Context) AwaitAll(futures ...sdk.Future) ([]sdk.Response, error) {
+	return awaitFutures(c.client, c.sessionId, futures, false)
+}
+
+func (c Context) AwaitAny(futures ...sdk.Future) (int, sdk.Response, error) {
+	responses, err := awaitFutures(c.client, c.sessionId, futures, true)
+	if err != nil {
+		return -1, nil, err
+	}
+
+	for i, res := range responses {
+		if res != nil {
+			return i, res, nil
+		}
+	}
+	return -1, nil, ErrTaskExecError.Wrap(errors.New("no completed call"))
+}
+
 func (c Context) Signal(signalName string) sdk.Signal {
-	// not implemented, old architecture is not good
-	panic("implement me")
+	return &Signal{
+		client:    c.client,
+		sessionId: c.sessionId,
+		name:      signalName,
+	}
+}
+
+// Sleep pauses the workflow durably; the task halts and is resumed by the sidecar once the duration has passed.
+func (c Context) Sleep(duration time.Duration) error {
+	return c.client.Sleep(c.sessionId, SleepRequest{
+		Duration: duration.Milliseconds(),
+	})
+}
+
+// SleepUntil pauses the workflow durably until the given time.
+func (c Context) SleepUntil(until time.Time) error {
+	return c.client.Sleep(c.sessionId, SleepRequest{
+		Until: until.UnixMilli(),
+	})
+}
+
+// GetVersion returns the code version recorded for changeId. New instances record maxSupported,
+// while instances that already ran past this point before the change existed get sdk.DefaultVersion.
+// Whether the marker is in the journal is decided by the sidecar, which keeps the journal.
+func (c Context) GetVersion(changeId string, minSupported int, maxSupported int) (int, error) {
+	res, err := c.client.GetVersion(c.sessionId, VersionRequest{
+		ChangeId:   changeId,
+		MaxVersion: maxSupported,
+	})
+	if err != nil {
+		return sdk.DefaultVersion, err
+	}
+
+	version := res.Version
+	if !res.Recorded {
+		version = sdk.DefaultVersion
+	}
+
+	if version < minSupported || version > maxSupported {
+		return sdk.DefaultVersion, sdk.ErrUnsupportedVersion.With(changeId, version, minSupported, maxSupported)
+	}
+	return version, nil
 }
 
 func (c Context) ClientChannel(channelName string) sdk.ClientChannel {
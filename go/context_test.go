@@ -0,0 +1,179 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+func TestTimers_FireAfterTheirDuration(t *testing.T) {
+	fired := make(map[string]bool)
+	client := newTestClient(t, &testService{
+		name: "timers",
+		workflows: map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error){
+			"Nap": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				err := ctx.Sleep(time.Duration(input.Count) * time.Minute)
+				fired[input.Name] = err == nil
+				return nil, err
+			},
+			"Wait": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				_, err := ctx.Signal("go").AwaitWithTimeout(time.Duration(input.Count) * time.Minute)
+				fired[input.Name] = sdk.IsError(err, sdk.ErrSignalTimeout)
+				return nil, nil
+			},
+		},
+	})
+
+	runService(client, "timers", "Nap", testInput{Name: "nap", Count: 10})
+	runService(client, "timers", "Wait", testInput{Name: "wait", Count: 10})
+	if fired["nap"] || fired["wait"] {
+		t.Fatal("timers fired before their duration")
+	}
+
+	client.Advance(9 * time.Minute)
+	client.RunPending(context.Background())
+	if fired["nap"] || fired["wait"] {
+		t.Fatal("timers fired before their duration")
+	}
+
+	client.Advance(2 * time.Minute)
+	client.RunPending(context.Background())
+	if !fired["nap"] || !fired["wait"] {
+		t.Fatalf("timers did not fire after their duration %v", fired)
+	}
+}
+
+func TestTimerRequests_AreMilliseconds(t *testing.T) {
+	sleep, _ := json.Marshal(SleepRequest{Duration: (2 * time.Second).Milliseconds()})
+	wait, _ := json.Marshal(SignalWaitRequest{SignalName: "go", Timeout: (3 * time.Second).Milliseconds()})
+	if string(sleep) != `{"duration":2000,"until":0}` || string(wait) != `{"signalName":"go","timeout":3000}` {
+		t.Fatalf("unexpected timer requests %s %s", sleep, wait)
+	}
+}
+
+func TestGetVersion_OldInstancesKeepTheirPath(t *testing.T) {
+	changed := false
+	versions := make(map[string]int)
+	client := newTestClient(t, &testService{
+		name: "shipping",
+		workflows: map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error){
+			"Ship": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				version := sdk.DefaultVersion
+				if changed {
+					var err error
+					version, err = ctx.GetVersion("express", sdk.DefaultVersion, 1)
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				err := ctx.Sleep(time.Minute)
+				if err != nil {
+					return nil, err
+				}
+
+				versions[input.Name] = version
+				if version == 1 {
+					// only new instances reach the new step
+					_, err = ctx.GetVersion("express", 1, 1)
+				}
+				return version, err
+			},
+		},
+	})
+
+	runService(client, "shipping", "Ship", testInput{Name: "old"})
+
+	changed = true
+	runService(client, "shipping", "Ship", testInput{Name: "new"})
+
+	client.Advance(time.Minute)
+	client.RunPending(context.Background())
+
+	if versions["old"] != sdk.DefaultVersion || versions["new"] != 1 {
+		t.Fatalf("expected old instance at the default version and new at 1, got %v", versions)
+	}
+}
+
+func TestGetVersion_MarkerBeforeAHaltedStep(t *testing.T) {
+	changed := false
+	versions := make(map[string][]int)
+	client := newTestClient(t, &testService{
+		name: "shipping",
+		workflows: map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error){
+			"Ship": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				err := ctx.Sleep(time.Minute)
+				if err != nil {
+					return nil, err
+				}
+
+				if changed {
+					// added right before the step the old instance is halted on
+					version, err := ctx.GetVersion("express", sdk.DefaultVersion, 1)
+					if err != nil {
+						return nil, err
+					}
+					versions[input.Name] = append(versions[input.Name], version)
+				}
+
+				err = ctx.Sleep(time.Minute)
+				if err != nil {
+					return nil, err
+				}
+
+				if changed {
+					// past the journal the change keeps the version found before
+					version, err := ctx.GetVersion("express", sdk.DefaultVersion, 1)
+					if err != nil {
+						return nil, err
+					}
+					versions[input.Name] = append(versions[input.Name], version)
+				}
+				return nil, nil
+			},
+		},
+	})
+
+	runService(client, "shipping", "Ship", testInput{Name: "old"})
+	client.Advance(time.Minute)
+	client.RunPending(context.Background())
+
+	changed = true
+	runService(client, "shipping", "Ship", testInput{Name: "new"})
+	for i := 0; i < 2; i++ {
+		client.Advance(time.Minute)
+		client.RunPending(context.Background())
+	}
+
+	if fmt.Sprint(versions["old"]) != "[-1 -1]" {
+		t.Fatalf("expected the halted instance to stay at the default version, got %v", versions["old"])
+	}
+	if fmt.Sprint(versions["new"]) != "[1 1 1]" {
+		t.Fatalf("expected the new instance at version 1 on every replay, got %v", versions["new"])
+	}
+}
+
+func TestGetVersion_RejectsUnsupportedVersion(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "shipping",
+		workflows: map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error){
+			"Ship": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				_, err := ctx.GetVersion("express", 1, 2)
+				if err != nil {
+					return nil, err
+				}
+				return ctx.GetVersion("express", 3, 3)
+			},
+		},
+	})
+
+	evt := runService(client, "shipping", "Ship", testInput{})
+	if !evt.IsError || !strings.Contains(evt.Error.CauseBy, "recorded version 2, supported range is [3, 3]") {
+		t.Fatalf("expected an unsupported version error, got %+v", evt)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"github.com/cloudimpl/polycode-runtime/go/sdk"
+	"iter"
+	"maps"
+	"slices"
 	"time"
 )
 
@@ -119,6 +122,7 @@ func (d *DataStore) ServiceCollection(name string) sdk.Collection {
 		sessionId:  d.sessionId,
 		tenantId:   d.tenantId,
 		scope:      sdk.DataScopeService,
+		name:       name,
 		path:       name,
 		parentPath: "",
 
@@ -135,6 +139,7 @@ func (d *DataStore) AppCollection(name string) sdk.Collection {
 		sessionId:  d.sessionId,
 		tenantId:   d.tenantId,
 		scope:      sdk.DataScopeApp,
+		name:       name,
 		path:       name,
 		parentPath: "",
 
@@ -143,6 +148,28 @@ func (d *DataStore) AppCollection(name string) sdk.Collection {
 	}
 }
 
+// Transaction runs fn against a datastore whose writes are committed atomically once fn returns
+// without an error. The commit fails with sdk.ErrConflict when a document read in the
+// transaction changed in the meantime. A nested transaction joins the outer one.
+func (d *DataStore) Transaction(fn func(tx sdk.DataStore) error) error {
+	if _, ok := d.client.(*txClient); ok {
+		return fn(d)
+	}
+
+	tx := newTxClient(d.client)
+	err := fn(&DataStore{
+		client:        tx,
+		sessionId:     d.sessionId,
+		tenantId:      d.tenantId,
+		modelRegistry: d.modelRegistry,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.commit(d.sessionId)
+}
+
 var _ sdk.DataStore = (*DataStore)(nil)
 
 type ReadOnlyCollection struct {
@@ -179,8 +206,14 @@ func (c *ReadOnlyCollection) GetOne(id string) (sdk.ReadOnlyDoc, error) {
 		path:      c.Path() + "/" + id,
 		version:   data.Version,
 		item:      data.Data,
+		createdAt: data.CreatedAt,
+		updatedAt: data.UpdatedAt,
+		expiresAt: data.ExpiresAt,
+
+		schemaVersion: data.SchemaVersion,
 
 		modelRegistry: c.modelRegistry,
+		collection:    c.name,
 		typeName:      c.typeName,
 	}, nil
 }
@@ -194,6 +227,7 @@ func (c *ReadOnlyCollection) Query() sdk.ReadOnlyQuery {
 		collectionPath: c.Path(),
 
 		modelRegistry: c.modelRegistry,
+		collection:    c.name,
 		typeName:      c.typeName,
 	}
 }
@@ -238,19 +272,169 @@ func (c *Collection) GetOne(id string) (sdk.Doc, error) {
 		path:      c.Path() + "/" + id,
 		version:   data.Version,
 		item:      data.Data,
+		createdAt: data.CreatedAt,
+		updatedAt: data.UpdatedAt,
+		expiresAt: data.ExpiresAt,
+
+		schemaVersion: data.SchemaVersion,
 
 		modelRegistry: c.modelRegistry,
+		collection:    c.name,
 		typeName:      c.typeName,
 	}, nil
 }
 
 func (c *Collection) InsertOne(id string, item interface{}, opts ...sdk.WriteOption) (sdk.Doc, error) {
+	req, err := c.insertRequest(id, item, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.client.InsertData(c.sessionId, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Doc{
+		client:    c.client,
+		sessionId: c.sessionId,
+		tenantId:  c.tenantId,
+		scope:     c.scope,
+		path:      req.Path,
+		version:   res.Version,
+		item:      req.Item,
+		createdAt: res.CreatedAt,
+		updatedAt: res.UpdatedAt,
+		expiresAt: res.ExpiresAt,
+
+		schemaVersion: req.SchemaVersion,
+
+		modelRegistry: c.modelRegistry,
+		collection:    c.name,
+		typeName:      c.typeName,
+	}, nil
+}
+
+// InsertMany inserts all items in one request. opts apply to every item before the item's own options.
+func (c *Collection) InsertMany(items []sdk.InsertItem, opts ...sdk.WriteOption) ([]sdk.BatchResult, error) {
+	req := InsertManyRequest{
+		Items: make([]InsertDataRequest, 0, len(items)),
+	}
+	for _, item := range items {
+		insertReq, err := c.insertRequest(item.Id, item.Item, append(slices.Clip(opts), item.Opts...))
+		if err != nil {
+			return nil, err
+		}
+		req.Items = append(req.Items, insertReq)
+	}
+
+	res, err := c.client.InsertMany(c.sessionId, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.Results, nil
+}
+
+func (c *Collection) UpdateMany(filter string, args []interface{}, patch map[string]interface{}, opts ...sdk.WriteOption) ([]sdk.BatchResult, error) {
+	cfg := &sdk.WriteConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var patchMap map[string]interface{}
+	err := ConvertType(patch, &patchMap)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]sdk.PatchOp, 0, len(patchMap))
+	for _, field := range slices.Sorted(maps.Keys(patchMap)) {
+		ops = append(ops, sdk.Set(field, patchMap[field]))
+	}
+	err = c.modelRegistry.ValidatePatch(c.name, c.Path(), ops)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.client.UpdateMany(c.sessionId, UpdateManyRequest{
+		Scope:          c.scope,
+		TenantId:       c.tenantId,
+		CollectionPath: c.Path(),
+		Filter:         filter,
+		Args:           args,
+		Patch:          patchMap,
+		Cfg:            *cfg,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Results, nil
+}
+
+// UpdateWithRetry reads the document, calls mutate to change it in place and writes it back guarded
+// by the version it read. On sdk.ErrConflict it starts over with backoff, up to maxAttempts attempts.
+// It is not replay-safe: the backoff sleeps and the reads and writes of every attempt are not
+// journaled, so workflows should call it inside a Memo step.
+func (c *Collection) UpdateWithRetry(id string, mutate func(current map[string]interface{}) error, maxAttempts int, opts ...sdk.WriteOption) error {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	// errors other than a conflict end the retries
+	var failed error
+	err := RetryWithBackoff(func() error {
+		doc, err := c.GetOne(id)
+		if err != nil {
+			failed = err
+			return nil
+		}
+
+		var current map[string]interface{}
+		err = doc.Unmarshal(&current)
+		if err == nil {
+			err = mutate(current)
+		}
+		if err == nil {
+			err = doc.(*Doc).write(current, opts...)
+		}
+
+		if sdk.IsError(err, sdk.ErrConflict) {
+			return err
+		}
+		failed = err
+		return nil
+	}, maxAttempts-1, 10*time.Millisecond, 10*time.Millisecond, time.Second, 0.2)
+	if err != nil {
+		return err
+	}
+	return failed
+}
+
+func (c *Collection) DeleteMany(filter string, args []interface{}, opts ...sdk.WriteOption) ([]sdk.BatchResult, error) {
+	cfg := &sdk.WriteConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	res, err := c.client.DeleteMany(c.sessionId, DeleteManyRequest{
+		Scope:          c.scope,
+		TenantId:       c.tenantId,
+		CollectionPath: c.Path(),
+		Filter:         filter,
+		Args:           args,
+		Cfg:            *cfg,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Results, nil
+}
+
+func (c *Collection) insertRequest(id string, item interface{}, opts []sdk.WriteOption) (InsertDataRequest, error) {
 	typeName := GetTypeName(item)
 
-	if c.typeName == "" {
-		fmt.Printf("inserting data into unregistered collection %s", c.Path())
-	} else if typeName != c.typeName {
-		return nil, fmt.Errorf("type name mismatch: expected %s, got %s", c.typeName, typeName)
+	if c.typeName != "" && typeName != c.typeName {
+		return InsertDataRequest{}, fmt.Errorf("type name mismatch: expected %s, got %s", c.typeName, typeName)
 	}
 
 	cfg := &sdk.WriteConfig{
@@ -267,10 +451,15 @@ func (c *Collection) InsertOne(id string, item interface{}, opts ...sdk.WriteOpt
 	var itemMap map[string]interface{}
 	err := ConvertType(item, &itemMap)
 	if err != nil {
-		return nil, err
+		return InsertDataRequest{}, err
 	}
 
-	err = c.client.InsertData(c.sessionId, InsertDataRequest{
+	err = c.modelRegistry.Validate(c.name, c.Path()+"/"+id, itemMap)
+	if err != nil {
+		return InsertDataRequest{}, err
+	}
+
+	return InsertDataRequest{
 		Scope:          c.scope,
 		TenantId:       c.tenantId,
 		Path:           c.Path() + "/" + id,
@@ -279,23 +468,8 @@ func (c *Collection) InsertOne(id string, item interface{}, opts ...sdk.WriteOpt
 		Type:           c.name,
 		Id:             id,
 		Item:           itemMap,
+		SchemaVersion:  c.modelRegistry.SchemaVersion(c.name),
 		Cfg:            *cfg,
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &Doc{
-		client:    c.client,
-		sessionId: c.sessionId,
-		tenantId:  c.tenantId,
-		scope:     c.scope,
-		path:      c.Path() + "/" + id,
-		item:      itemMap,
-
-		modelRegistry: c.modelRegistry,
-		typeName:      c.typeName,
 	}, nil
 }
 
@@ -308,6 +482,7 @@ func (c *Collection) Query() sdk.Query {
 		collectionPath: c.Path(),
 
 		modelRegistry: c.modelRegistry,
+		collection:    c.name,
 		typeName:      c.typeName,
 	}
 }
@@ -316,6 +491,10 @@ func (c *Collection) Path() string {
 	return c.path
 }
 
+func (c *Collection) TypeName() string {
+	return c.typeName
+}
+
 var _ sdk.Collection = (*Collection)(nil)
 
 type ReadOnlyDoc struct {
@@ -326,9 +505,16 @@ type ReadOnlyDoc struct {
 	path      string
 	version   int64
 	item      map[string]interface{}
+	createdAt time.Time
+	updatedAt time.Time
+	expiresAt time.Time
 
 	modelRegistry *ModelRegistry
+	collection    string
 	typeName      string
+	schemaVersion int
+	// projected docs were read with Select and hold only the selected fields
+	projected bool
 }
 
 func (r *ReadOnlyDoc) ChildCollection(name string) sdk.ReadOnlyCollection {
@@ -352,7 +538,36 @@ func (r *ReadOnlyDoc) Path() string {
 	return r.path
 }
 
+func (r *ReadOnlyDoc) Ref() sdk.DocRef {
+	return sdk.DocRef{
+		Scope:    r.scope,
+		TenantId: r.tenantId,
+		Path:     r.path,
+	}
+}
+
+func (r *ReadOnlyDoc) Version() int64 {
+	return r.version
+}
+
+func (r *ReadOnlyDoc) CreatedAt() time.Time {
+	return r.createdAt
+}
+
+func (r *ReadOnlyDoc) UpdatedAt() time.Time {
+	return r.updatedAt
+}
+
+func (r *ReadOnlyDoc) ExpiresAt() time.Time {
+	return r.expiresAt
+}
+
+// Unmarshal decodes the document in the current shape of its model, upgrading older documents first
 func (r *ReadOnlyDoc) Unmarshal(item interface{}) error {
+	err := r.upgrade()
+	if err != nil {
+		return err
+	}
 	return ConvertType(r.item, item)
 }
 
@@ -366,9 +581,16 @@ type Doc struct {
 	path      string
 	version   int64
 	item      map[string]interface{}
+	createdAt time.Time
+	updatedAt time.Time
+	expiresAt time.Time
 
 	modelRegistry *ModelRegistry
+	collection    string
 	typeName      string
+	schemaVersion int
+	// projected docs were read with Select and hold only the selected fields
+	projected bool
 }
 
 func (d *Doc) ExpireIn(expireIn time.Duration, opts ...sdk.WriteOption) error {
@@ -383,23 +605,42 @@ func (d *Doc) ExpireIn(expireIn time.Duration, opts ...sdk.WriteOption) error {
 		opt(cfg)
 	}
 
-	return d.client.UpdateTTL(d.sessionId, UpdateTTLRequest{
+	res, err := d.client.UpdateTTL(d.sessionId, UpdateTTLRequest{
 		Scope:    d.scope,
 		TenantId: d.tenantId,
 		Path:     d.Path(),
 		Cfg:      *cfg,
 	})
+	if err != nil {
+		return err
+	}
+
+	d.written(res)
+	return nil
 }
 
 func (d *Doc) Update(item interface{}, opts ...sdk.WriteOption) error {
+	if d.projected {
+		return sdk.ErrPartialDocument.With(d.Path())
+	}
+
 	typeName := GetTypeName(item)
 
-	if d.typeName == "" {
-		fmt.Printf("updating data into unregistered collection %s", d.Path())
-	} else if d.typeName != typeName {
+	if d.typeName != "" && d.typeName != typeName {
 		return fmt.Errorf("type mismatch, expected: %s, given: %s", d.typeName, typeName)
 	}
 
+	var itemMap map[string]interface{}
+	err := ConvertType(item, &itemMap)
+	if err != nil {
+		return err
+	}
+
+	return d.write(itemMap, opts...)
+}
+
+// write validates itemMap and stores it as the document, guarded by the version the doc was read at
+func (d *Doc) write(itemMap map[string]interface{}, opts ...sdk.WriteOption) error {
 	cfg := &sdk.WriteConfig{
 		VersionEquals: d.version,
 		ExpireIn:      0,
@@ -411,20 +652,153 @@ func (d *Doc) Update(item interface{}, opts ...sdk.WriteOption) error {
 		opt(cfg)
 	}
 
-	var itemMap map[string]interface{}
-	err := ConvertType(item, &itemMap)
+	err := d.modelRegistry.Validate(d.collection, d.Path(), itemMap)
 	if err != nil {
 		return err
 	}
 
 	d.item = itemMap
-	return d.client.UpdateData(d.sessionId, UpdateDataRequest{
+	d.schemaVersion = d.modelRegistry.SchemaVersion(d.collection)
+	res, err := d.client.UpdateData(d.sessionId, UpdateDataRequest{
+		Scope:         d.scope,
+		TenantId:      d.tenantId,
+		Path:          d.Path(),
+		Item:          itemMap,
+		SchemaVersion: d.schemaVersion,
+		Cfg:           *cfg,
+	})
+	if err != nil {
+		return err
+	}
+
+	d.written(res)
+	return nil
+}
+
+// written keeps the doc in step with the stored document after a write. Writes buffered in a
+// transaction report only the pending version, or none when it is not known yet, and keep the
+// timestamps as they were read.
+func (d *Doc) written(res WriteDataResponse) {
+	if res.Version == 0 {
+		return
+	}
+
+	d.version = res.Version
+	if res.UpdatedAt.IsZero() {
+		return
+	}
+	d.createdAt = res.CreatedAt
+	d.updatedAt = res.UpdatedAt
+	d.expiresAt = res.ExpiresAt
+}
+
+func (d *Doc) Patch(ops []sdk.PatchOp, opts ...sdk.WriteOption) error {
+	if d.projected {
+		return sdk.ErrPartialDocument.With(d.Path())
+	}
+
+	// the operations apply to the stored document, so there is no version guard by default
+	cfg := &sdk.WriteConfig{
+		VersionEquals: 0,
+		ExpireIn:      0,
+		Unsafe:        false,
+		Upsert:        false,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	// values are sent in their json form so they compare like the stored ones
+	var normalized []sdk.PatchOp
+	err := ConvertType(ops, &normalized)
+	if err != nil {
+		return err
+	}
+
+	err = d.modelRegistry.ValidatePatch(d.collection, d.Path(), normalized)
+	if err != nil {
+		return err
+	}
+
+	data, err := d.client.PatchData(d.sessionId, PatchDataRequest{
+		Scope:         d.scope,
+		TenantId:      d.tenantId,
+		Path:          d.Path(),
+		Ops:           normalized,
+		SchemaVersion: d.modelRegistry.SchemaVersion(d.collection),
+		Cfg:           *cfg,
+	})
+	if sdk.IsError(err, sdk.ErrStaleSchema) {
+		// the operations were validated against the current model, so the document is upgraded first
+		data, err = d.patchUpgraded(normalized, *cfg)
+	}
+	if err != nil {
+		return err
+	}
+
+	d.item = data.Data
+	d.version = data.Version
+	d.createdAt = data.CreatedAt
+	d.updatedAt = data.UpdatedAt
+	d.expiresAt = data.ExpiresAt
+	return nil
+}
+
+// patchUpgraded applies ops to the stored document upgraded to the current schema version and
+// writes it back, guarded by the version it read unless cfg sets one.
+func (d *Doc) patchUpgraded(ops []sdk.PatchOp, cfg sdk.WriteConfig) (GetDataResponse, error) {
+	stored, err := d.client.GetData(d.sessionId, GetDataRequest{
 		Scope:    d.scope,
 		TenantId: d.tenantId,
 		Path:     d.Path(),
-		Item:     itemMap,
-		Cfg:      *cfg,
 	})
+	if err != nil {
+		return GetDataResponse{}, err
+	} else if !stored.Exist {
+		return GetDataResponse{}, sdk.ErrNotFound
+	}
+
+	item, err := copyData(stored.Data)
+	if err != nil {
+		return GetDataResponse{}, err
+	}
+
+	item, schemaVersion, err := d.modelRegistry.Upgrade(d.collection, stored.SchemaVersion, item)
+	if err != nil {
+		return GetDataResponse{}, err
+	}
+
+	err = applyPatch(item, ops)
+	if err != nil {
+		return GetDataResponse{}, err
+	}
+
+	if cfg.VersionEquals == 0 && !cfg.Unsafe {
+		cfg.VersionEquals = stored.Version
+	}
+	res, err := d.client.UpdateData(d.sessionId, UpdateDataRequest{
+		Scope:         d.scope,
+		TenantId:      d.tenantId,
+		Path:          d.Path(),
+		Item:          item,
+		SchemaVersion: schemaVersion,
+		Cfg:           cfg,
+	})
+	if err != nil {
+		return GetDataResponse{}, err
+	}
+
+	return GetDataResponse{
+		Path:          d.Path(),
+		Exist:         true,
+		Version:       res.Version,
+		SchemaVersion: schemaVersion,
+		Data:          item,
+		CreatedAt:     res.CreatedAt,
+		UpdatedAt:     res.UpdatedAt,
+		ExpiresAt:     res.ExpiresAt,
+	}, nil
 }
 
 func (d *Doc) Delete(opts ...sdk.WriteOption) error {
@@ -468,7 +842,59 @@ func (d *Doc) Path() string {
 	return d.path
 }
 
+func (d *Doc) Ref() sdk.DocRef {
+	return sdk.DocRef{
+		Scope:    d.scope,
+		TenantId: d.tenantId,
+		Path:     d.path,
+	}
+}
+
+func (d *Doc) Version() int64 {
+	return d.version
+}
+
+func (d *Doc) CreatedAt() time.Time {
+	return d.createdAt
+}
+
+func (d *Doc) UpdatedAt() time.Time {
+	return d.updatedAt
+}
+
+func (d *Doc) ExpiresAt() time.Time {
+	return d.expiresAt
+}
+
+// Refresh reloads the document, returning sdk.ErrNotFound when it no longer exists
+func (d *Doc) Refresh() error {
+	data, err := d.client.GetData(d.sessionId, GetDataRequest{
+		Scope:    d.scope,
+		TenantId: d.tenantId,
+		Path:     d.Path(),
+	})
+	if err != nil {
+		return err
+	} else if !data.Exist {
+		return sdk.ErrNotFound
+	}
+
+	d.version = data.Version
+	d.item = data.Data
+	d.createdAt = data.CreatedAt
+	d.updatedAt = data.UpdatedAt
+	d.expiresAt = data.ExpiresAt
+	d.schemaVersion = data.SchemaVersion
+	d.projected = false
+	return nil
+}
+
+// Unmarshal decodes the document in the current shape of its model, upgrading older documents first
 func (d *Doc) Unmarshal(item interface{}) error {
+	err := d.upgrade()
+	if err != nil {
+		return err
+	}
 	return ConvertType(d.item, item)
 }
 
@@ -482,15 +908,42 @@ type ReadOnlyQuery struct {
 	collectionPath string
 	filter         string
 	args           []any
+	orderBy        []sdk.OrderBy
+	fields         []string
 	limit          int
+	groupBy        []string
+	err            error
 
 	modelRegistry *ModelRegistry
+	collection    string
 	typeName      string
 }
 
 func (r *ReadOnlyQuery) Filter(expr string, args ...interface{}) sdk.ReadOnlyQuery {
 	r.filter = expr
 	r.args = args
+	r.err = nil
+	return r
+}
+
+// Where filters by a condition built with sdk.F, its fields are checked against the registered model
+func (r *ReadOnlyQuery) Where(condition sdk.Condition) sdk.ReadOnlyQuery {
+	r.filter = condition.Expr()
+	r.args = condition.Args()
+	r.err = r.modelRegistry.CheckFields(r.collection, r.collectionPath, condition.Fields())
+	return r
+}
+
+func (r *ReadOnlyQuery) OrderBy(field string, order sdk.SortOrder) sdk.ReadOnlyQuery {
+	r.orderBy = append(r.orderBy, sdk.OrderBy{
+		Field: field,
+		Order: order,
+	})
+	return r
+}
+
+func (r *ReadOnlyQuery) Select(fields ...string) sdk.ReadOnlyQuery {
+	r.fields = fields
 	return r
 }
 
@@ -499,23 +952,157 @@ func (r *ReadOnlyQuery) Limit(limit int) sdk.ReadOnlyQuery {
 	return r
 }
 
+func (r *ReadOnlyQuery) GroupBy(fields ...string) sdk.ReadOnlyQuery {
+	r.groupBy = fields
+	return r
+}
+
 func (r *ReadOnlyQuery) GetOne(ctx context.Context) (sdk.ReadOnlyDoc, error) {
-	data, err := r.client.QueryData(r.sessionId, QueryDataRequest{
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	data, err := r.client.QueryData(r.sessionId, r.request(""))
+	if err != nil {
+		return nil, err
+	} else if data.Data == nil || len(data.Data) == 0 {
+		return nil, sdk.ErrNotFound
+	}
+
+	return r.doc(data.Data[0]), nil
+}
+
+func (r *ReadOnlyQuery) GetAll(ctx context.Context) ([]sdk.ReadOnlyDoc, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	docs := make([]sdk.ReadOnlyDoc, 0)
+	err := queryAll(ctx, r.client, r.sessionId, r.request(""), func(item GetDataResponse) bool {
+		docs = append(docs, r.doc(item))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return docs, nil
+}
+
+func (r *ReadOnlyQuery) Page(ctx context.Context, token string) ([]sdk.ReadOnlyDoc, string, error) {
+	if r.err != nil {
+		return nil, "", r.err
+	}
+
+	data, err := r.client.QueryData(r.sessionId, r.request(token))
+	if err != nil {
+		return nil, "", err
+	}
+
+	docs := make([]sdk.ReadOnlyDoc, 0, len(data.Data))
+	for _, item := range data.Data {
+		docs = append(docs, r.doc(item))
+	}
+	return docs, data.NextToken, nil
+}
+
+func (r *ReadOnlyQuery) Iter(ctx context.Context) iter.Seq2[sdk.ReadOnlyDoc, error] {
+	return func(yield func(sdk.ReadOnlyDoc, error) bool) {
+		if r.err != nil {
+			yield(nil, r.err)
+			return
+		}
+
+		err := queryAll(ctx, r.client, r.sessionId, r.request(""), func(item GetDataResponse) bool {
+			return yield(r.doc(item), nil)
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+func (r *ReadOnlyQuery) Count(ctx context.Context) (int64, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	var count int64
+	err := aggregateOne(r.client, r.sessionId, r.aggregateRequest(nil), sdk.Count(), &count)
+	return count, err
+}
+
+func (r *ReadOnlyQuery) Sum(ctx context.Context, field string) (float64, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	var sum float64
+	err := aggregateOne(r.client, r.sessionId, r.aggregateRequest(nil), sdk.Sum(field), &sum)
+	return sum, err
+}
+
+func (r *ReadOnlyQuery) Min(ctx context.Context, field string) (any, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var min any
+	err := aggregateOne(r.client, r.sessionId, r.aggregateRequest(nil), sdk.Min(field), &min)
+	return min, err
+}
+
+func (r *ReadOnlyQuery) Max(ctx context.Context, field string) (any, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var max any
+	err := aggregateOne(r.client, r.sessionId, r.aggregateRequest(nil), sdk.Max(field), &max)
+	return max, err
+}
+
+func (r *ReadOnlyQuery) Aggregate(ctx context.Context, aggregates ...sdk.Aggregate) ([]sdk.AggregateGroup, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	req := r.aggregateRequest(r.groupBy)
+	req.Aggregates = aggregates
+
+	data, err := r.client.AggregateData(r.sessionId, req)
+	if err != nil {
+		return nil, err
+	}
+	return data.Groups, nil
+}
+
+func (r *ReadOnlyQuery) aggregateRequest(groupBy []string) AggregateDataRequest {
+	return AggregateDataRequest{
 		Scope:          r.scope,
 		TenantId:       r.tenantId,
 		CollectionPath: r.collectionPath,
 		Filter:         r.filter,
 		Args:           r.args,
-		Limit:          r.limit,
-	})
+		GroupBy:        groupBy,
+	}
+}
 
-	if err != nil {
-		return nil, err
-	} else if data.Data == nil || len(data.Data) == 0 {
-		return nil, sdk.ErrNotFound
+func (r *ReadOnlyQuery) request(token string) QueryDataRequest {
+	return QueryDataRequest{
+		Scope:          r.scope,
+		TenantId:       r.tenantId,
+		CollectionPath: r.collectionPath,
+		Filter:         r.filter,
+		Args:           r.args,
+		OrderBy:        r.orderBy,
+		Select:         r.fields,
+		OffsetToken:    token,
+		Limit:          r.limit,
 	}
+}
 
-	item := data.Data[0]
+func (r *ReadOnlyQuery) doc(item GetDataResponse) *ReadOnlyDoc {
 	return &ReadOnlyDoc{
 		client:    r.client,
 		sessionId: r.sessionId,
@@ -524,45 +1111,17 @@ func (r *ReadOnlyQuery) GetOne(ctx context.Context) (sdk.ReadOnlyDoc, error) {
 		path:      item.Path,
 		version:   item.Version,
 		item:      item.Data,
+		createdAt: item.CreatedAt,
+		updatedAt: item.UpdatedAt,
+		expiresAt: item.ExpiresAt,
+
+		schemaVersion: item.SchemaVersion,
+		projected:     len(r.fields) > 0,
 
 		modelRegistry: r.modelRegistry,
+		collection:    r.collection,
 		typeName:      r.typeName,
-	}, nil
-}
-
-func (r *ReadOnlyQuery) GetAll(ctx context.Context) ([]sdk.ReadOnlyDoc, error) {
-	data, err := r.client.QueryData(r.sessionId, QueryDataRequest{
-		Scope:          r.scope,
-		TenantId:       r.tenantId,
-		CollectionPath: r.collectionPath,
-		Filter:         r.filter,
-		Args:           r.args,
-		Limit:          r.limit,
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	docs := make([]sdk.ReadOnlyDoc, 0)
-	if data.Data != nil && len(data.Data) > 0 {
-		for _, item := range data.Data {
-			docs = append(docs, &ReadOnlyDoc{
-				client:    r.client,
-				sessionId: r.sessionId,
-				tenantId:  r.tenantId,
-				scope:     r.scope,
-				path:      item.Path,
-				version:   item.Version,
-				item:      item.Data,
-
-				modelRegistry: r.modelRegistry,
-				typeName:      r.typeName,
-			})
-		}
 	}
-
-	return docs, nil
 }
 
 var _ sdk.ReadOnlyQuery = (*ReadOnlyQuery)(nil)
@@ -575,15 +1134,42 @@ type Query struct {
 	collectionPath string
 	filter         string
 	args           []any
+	orderBy        []sdk.OrderBy
+	fields         []string
 	limit          int
+	groupBy        []string
+	err            error
 
 	modelRegistry *ModelRegistry
+	collection    string
 	typeName      string
 }
 
 func (q *Query) Filter(expr string, args ...interface{}) sdk.Query {
 	q.filter = expr
 	q.args = args
+	q.err = nil
+	return q
+}
+
+// Where filters by a condition built with sdk.F, its fields are checked against the registered model
+func (q *Query) Where(condition sdk.Condition) sdk.Query {
+	q.filter = condition.Expr()
+	q.args = condition.Args()
+	q.err = q.modelRegistry.CheckFields(q.collection, q.collectionPath, condition.Fields())
+	return q
+}
+
+func (q *Query) OrderBy(field string, order sdk.SortOrder) sdk.Query {
+	q.orderBy = append(q.orderBy, sdk.OrderBy{
+		Field: field,
+		Order: order,
+	})
+	return q
+}
+
+func (q *Query) Select(fields ...string) sdk.Query {
+	q.fields = fields
 	return q
 }
 
@@ -592,23 +1178,157 @@ func (q *Query) Limit(limit int) sdk.Query {
 	return q
 }
 
+func (q *Query) GroupBy(fields ...string) sdk.Query {
+	q.groupBy = fields
+	return q
+}
+
 func (q *Query) GetOne(ctx context.Context) (sdk.Doc, error) {
-	data, err := q.client.QueryData(q.sessionId, QueryDataRequest{
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	data, err := q.client.QueryData(q.sessionId, q.request(""))
+	if err != nil {
+		return nil, err
+	} else if data.Data == nil || len(data.Data) == 0 {
+		return nil, sdk.ErrNotFound
+	}
+
+	return q.doc(data.Data[0]), nil
+}
+
+func (q *Query) GetAll(ctx context.Context) ([]sdk.Doc, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	docs := make([]sdk.Doc, 0)
+	err := queryAll(ctx, q.client, q.sessionId, q.request(""), func(item GetDataResponse) bool {
+		docs = append(docs, q.doc(item))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return docs, nil
+}
+
+func (q *Query) Page(ctx context.Context, token string) ([]sdk.Doc, string, error) {
+	if q.err != nil {
+		return nil, "", q.err
+	}
+
+	data, err := q.client.QueryData(q.sessionId, q.request(token))
+	if err != nil {
+		return nil, "", err
+	}
+
+	docs := make([]sdk.Doc, 0, len(data.Data))
+	for _, item := range data.Data {
+		docs = append(docs, q.doc(item))
+	}
+	return docs, data.NextToken, nil
+}
+
+func (q *Query) Iter(ctx context.Context) iter.Seq2[sdk.Doc, error] {
+	return func(yield func(sdk.Doc, error) bool) {
+		if q.err != nil {
+			yield(nil, q.err)
+			return
+		}
+
+		err := queryAll(ctx, q.client, q.sessionId, q.request(""), func(item GetDataResponse) bool {
+			return yield(q.doc(item), nil)
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+func (q *Query) Count(ctx context.Context) (int64, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+
+	var count int64
+	err := aggregateOne(q.client, q.sessionId, q.aggregateRequest(nil), sdk.Count(), &count)
+	return count, err
+}
+
+func (q *Query) Sum(ctx context.Context, field string) (float64, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+
+	var sum float64
+	err := aggregateOne(q.client, q.sessionId, q.aggregateRequest(nil), sdk.Sum(field), &sum)
+	return sum, err
+}
+
+func (q *Query) Min(ctx context.Context, field string) (any, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	var min any
+	err := aggregateOne(q.client, q.sessionId, q.aggregateRequest(nil), sdk.Min(field), &min)
+	return min, err
+}
+
+func (q *Query) Max(ctx context.Context, field string) (any, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	var max any
+	err := aggregateOne(q.client, q.sessionId, q.aggregateRequest(nil), sdk.Max(field), &max)
+	return max, err
+}
+
+func (q *Query) Aggregate(ctx context.Context, aggregates ...sdk.Aggregate) ([]sdk.AggregateGroup, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	req := q.aggregateRequest(q.groupBy)
+	req.Aggregates = aggregates
+
+	data, err := q.client.AggregateData(q.sessionId, req)
+	if err != nil {
+		return nil, err
+	}
+	return data.Groups, nil
+}
+
+func (q *Query) aggregateRequest(groupBy []string) AggregateDataRequest {
+	return AggregateDataRequest{
 		Scope:          q.scope,
 		TenantId:       q.tenantId,
 		CollectionPath: q.collectionPath,
 		Filter:         q.filter,
 		Args:           q.args,
-		Limit:          q.limit,
-	})
+		GroupBy:        groupBy,
+	}
+}
 
-	if err != nil {
-		return nil, err
-	} else if data.Data == nil || len(data.Data) == 0 {
-		return nil, sdk.ErrNotFound
+func (q *Query) request(token string) QueryDataRequest {
+	return QueryDataRequest{
+		Scope:          q.scope,
+		TenantId:       q.tenantId,
+		CollectionPath: q.collectionPath,
+		Filter:         q.filter,
+		Args:           q.args,
+		OrderBy:        q.orderBy,
+		Select:         q.fields,
+		OffsetToken:    token,
+		Limit:          q.limit,
 	}
+}
 
-	item := data.Data[0]
+func (q *Query) doc(item GetDataResponse) *Doc {
 	return &Doc{
 		client:    q.client,
 		sessionId: q.sessionId,
@@ -617,44 +1337,68 @@ func (q *Query) GetOne(ctx context.Context) (sdk.Doc, error) {
 		path:      item.Path,
 		version:   item.Version,
 		item:      item.Data,
+		createdAt: item.CreatedAt,
+		updatedAt: item.UpdatedAt,
+		expiresAt: item.ExpiresAt,
+
+		schemaVersion: item.SchemaVersion,
+		projected:     len(q.fields) > 0,
 
 		modelRegistry: q.modelRegistry,
+		collection:    q.collection,
 		typeName:      q.typeName,
-	}, nil
+	}
 }
 
-func (q *Query) GetAll(ctx context.Context) ([]sdk.Doc, error) {
-	data, err := q.client.QueryData(q.sessionId, QueryDataRequest{
-		Scope:          q.scope,
-		TenantId:       q.tenantId,
-		CollectionPath: q.collectionPath,
-		Filter:         q.filter,
-		Args:           q.args,
-		Limit:          q.limit,
-	})
-	if err != nil {
-		return nil, err
-	}
+var _ sdk.Query = (*Query)(nil)
+
+// queryAll passes every document matching the request to fn, following next tokens across pages.
+// A limit caps the total number of documents rather than the size of a single page.
+func queryAll(ctx context.Context, client ServiceClient, sessionId string, req QueryDataRequest, fn func(item GetDataResponse) bool) error {
+	remaining := req.Limit
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		data, err := client.QueryData(sessionId, req)
+		if err != nil {
+			return err
+		}
 
-	docs := make([]sdk.Doc, 0)
-	if data.Data != nil && len(data.Data) > 0 {
 		for _, item := range data.Data {
-			docs = append(docs, &Doc{
-				client:    q.client,
-				sessionId: q.sessionId,
-				tenantId:  q.tenantId,
-				scope:     q.scope,
-				path:      item.Path,
-				version:   item.Version,
-				item:      item.Data,
-
-				modelRegistry: q.modelRegistry,
-				typeName:      q.typeName,
-			})
+			if !fn(item) {
+				return nil
+			}
+
+			if req.Limit > 0 {
+				remaining--
+				if remaining == 0 {
+					return nil
+				}
+			}
 		}
-	}
 
-	return docs, nil
+		if data.NextToken == "" {
+			return nil
+		}
+		req.OffsetToken = data.NextToken
+		if req.Limit > 0 {
+			req.Limit = remaining
+		}
+	}
 }
 
-var _ sdk.Query = (*Query)(nil)
+// aggregateOne computes a single aggregate over the whole query, leaving ret untouched when nothing matches.
+func aggregateOne(client ServiceClient, sessionId string, req AggregateDataRequest, aggregate sdk.Aggregate, ret any) error {
+	req.Aggregates = []sdk.Aggregate{aggregate}
+
+	data, err := client.AggregateData(sessionId, req)
+	if err != nil {
+		return err
+	} else if len(data.Groups) == 0 || len(data.Groups[0].Values) == 0 {
+		return nil
+	}
+
+	return ConvertType(data.Groups[0].Values[0], ret)
+}
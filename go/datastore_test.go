@@ -0,0 +1,722 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+// seedHandler inserts input.Count items named item-<i> with count i into the service collection input.Name
+func seedHandler(ctx sdk.ServiceContext, input *testInput) (any, error) {
+	collection := ctx.Db().Get().ServiceCollection(input.Name)
+	for i := 0; i < input.Count; i++ {
+		name := fmt.Sprintf("item-%03d", i)
+		_, err := collection.InsertOne(name, &testItem{Name: name, Count: i})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func mustRun(t *testing.T, client *MemoryServiceClient, service string, method string, input testInput) {
+	t.Helper()
+
+	evt := runService(client, service, method, input)
+	if evt.IsError {
+		t.Fatalf("%s failed: %s", method, evt.Error.Error())
+	}
+}
+
+func TestQuery_PagesThroughAllDocuments(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Seed": seedHandler,
+			"Scan": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				query := ctx.Db().Get().ServiceCollection("items").Query().OrderBy("count", sdk.SortDesc)
+
+				var counts []int
+				token := ""
+				for {
+					docs, next, err := query.Limit(input.Count).Page(ctx, token)
+					if err != nil {
+						return nil, err
+					}
+					for _, doc := range docs {
+						var item testItem
+						err = doc.Unmarshal(&item)
+						if err != nil {
+							return nil, err
+						}
+						counts = append(counts, item.Count)
+					}
+					if next == "" {
+						break
+					}
+					token = next
+				}
+
+				all, err := query.Limit(0).GetAll(ctx)
+				if err != nil {
+					return nil, err
+				}
+				limited, err := query.Limit(150).GetAll(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				iterated := 0
+				for _, err := range query.Limit(0).Iter(ctx) {
+					if err != nil {
+						return nil, err
+					}
+					iterated++
+					if iterated == 5 {
+						break
+					}
+				}
+				return []any{counts, len(all), len(limited), iterated}, nil
+			},
+		},
+	})
+
+	mustRun(t, client, "store", "Seed", testInput{Name: "items", Count: 250})
+
+	var out []any
+	mustOutput(t, runService(client, "store", "Scan", testInput{Count: 40}), &out)
+
+	var counts []int
+	err := ConvertType(out[0], &counts)
+	if err != nil {
+		t.Fatalf("failed to decode counts: %s", err.Error())
+	}
+	if len(counts) != 250 {
+		t.Fatalf("expected 250 documents across pages, got %d", len(counts))
+	}
+	for i, count := range counts {
+		if count != 249-i {
+			t.Fatalf("expected descending order, got %d at %d", count, i)
+		}
+	}
+	if out[1] != float64(250) || out[2] != float64(150) || out[3] != float64(5) {
+		t.Fatalf("expected 250 documents, 150 with a limit and 5 iterated, got %v", out[1:])
+	}
+}
+
+func TestQuery_SelectedDocsAreNotWritable(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Put": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				_, err := ctx.Db().Get().ServiceCollection("items").InsertOne(input.Name, &testItem{Name: input.Name, Count: input.Count})
+				return nil, err
+			},
+			"Rename": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				doc, err := ctx.Db().Get().ServiceCollection("items").Query().Select("name").GetOne(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				var item testItem
+				err = doc.Unmarshal(&item)
+				if err != nil {
+					return nil, err
+				}
+				if item.Count != 0 {
+					return nil, fmt.Errorf("expected only the name, got %+v", item)
+				}
+
+				item.Name = input.Name
+				if err = doc.Update(&item); !sdk.IsError(err, sdk.ErrPartialDocument) {
+					return nil, fmt.Errorf("expected update to fail, got %v", err)
+				}
+				if err = doc.Patch([]sdk.PatchOp{sdk.Set("name", input.Name)}); !sdk.IsError(err, sdk.ErrPartialDocument) {
+					return nil, fmt.Errorf("expected patch to fail, got %v", err)
+				}
+
+				// a refreshed doc holds the whole document again
+				err = doc.Refresh()
+				if err != nil {
+					return nil, err
+				}
+				err = doc.Unmarshal(&item)
+				if err != nil {
+					return nil, err
+				}
+				item.Name = input.Name
+				return nil, doc.Update(&item)
+			},
+			"Get": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				doc, err := ctx.Db().Get().ServiceCollection("items").GetOne(input.Name)
+				if err != nil {
+					return nil, err
+				}
+
+				var item testItem
+				err = doc.Unmarshal(&item)
+				return item, err
+			},
+		},
+	})
+
+	evt := runService(client, "store", "Put", testInput{Name: "a", Count: 7})
+	if evt.IsError {
+		t.Fatalf("put failed: %s", evt.Error.Error())
+	}
+	evt = runService(client, "store", "Rename", testInput{Name: "renamed"})
+	if evt.IsError {
+		t.Fatalf("rename failed: %s", evt.Error.Error())
+	}
+
+	var item testItem
+	mustOutput(t, runService(client, "store", "Get", testInput{Name: "a"}), &item)
+	if item != (testItem{Name: "renamed", Count: 7}) {
+		t.Fatalf("expected the unselected fields to be kept, got %+v", item)
+	}
+}
+
+func TestQuery_Aggregates(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Seed": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				for i := 0; i < 10; i++ {
+					parity := "even"
+					if i%2 == 1 {
+						parity = "odd"
+					}
+					_, err := ctx.Db().Get().ServiceCollection("items").InsertOne(fmt.Sprint(i), &testItem{Name: parity, Count: i})
+					if err != nil {
+						return nil, err
+					}
+				}
+				return nil, nil
+			},
+			"Stats": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				items := ctx.Db().Get().ServiceCollection("items")
+				count, err := items.Query().Filter("count >= ?", 5).Count(ctx)
+				if err != nil {
+					return nil, err
+				}
+				sum, err := items.Query().Sum(ctx, "count")
+				if err != nil {
+					return nil, err
+				}
+				min, err := items.Query().Min(ctx, "count")
+				if err != nil {
+					return nil, err
+				}
+				max, err := items.Query().Max(ctx, "count")
+				if err != nil {
+					return nil, err
+				}
+				groups, err := items.Query().GroupBy("name").Aggregate(ctx, sdk.Count(), sdk.Sum("count"))
+				if err != nil {
+					return nil, err
+				}
+
+				byName := make(map[string][]interface{})
+				for _, group := range groups {
+					byName[fmt.Sprint(group.Key["name"])] = group.Values
+				}
+				return map[string]any{"count": count, "sum": sum, "min": min, "max": max, "groups": byName}, nil
+			},
+		},
+	})
+
+	mustRun(t, client, "store", "Seed", testInput{})
+
+	var stats struct {
+		Count  int64              `json:"count"`
+		Sum    float64            `json:"sum"`
+		Min    float64            `json:"min"`
+		Max    float64            `json:"max"`
+		Groups map[string][]int64 `json:"groups"`
+	}
+	mustOutput(t, runService(client, "store", "Stats", testInput{}), &stats)
+	if stats.Count != 5 || stats.Sum != 45 || stats.Min != 0 || stats.Max != 9 {
+		t.Fatalf("unexpected aggregates %+v", stats)
+	}
+	if fmt.Sprint(stats.Groups["even"]) != "[5 20]" || fmt.Sprint(stats.Groups["odd"]) != "[5 25]" {
+		t.Fatalf("unexpected groups %v", stats.Groups)
+	}
+}
+
+func TestCollection_BatchWrites(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Seed": seedHandler,
+			"Batch": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				items := ctx.Db().Get().ServiceCollection("items")
+				inserted, err := items.InsertMany([]sdk.InsertItem{
+					{Id: "item-010", Item: &testItem{Name: "item-010", Count: 10}},
+					{Id: "item-000", Item: &testItem{Name: "duplicate"}},
+					{Id: "item-011", Item: &testItem{Name: "item-011", Count: 11}},
+				})
+				if err != nil {
+					return nil, err
+				}
+				updated, err := items.UpdateMany("count < ?", []interface{}{3}, map[string]interface{}{"name": "small"})
+				if err != nil {
+					return nil, err
+				}
+				deleted, err := items.DeleteMany("count >= ?", []interface{}{9})
+				if err != nil {
+					return nil, err
+				}
+
+				var failed []string
+				for _, result := range inserted {
+					if result.IsError {
+						failed = append(failed, result.Path)
+					}
+				}
+				small, err := items.Query().Filter("name = ?", "small").Count(ctx)
+				if err != nil {
+					return nil, err
+				}
+				total, err := items.Query().Count(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return []any{failed, len(updated), small, len(deleted), total}, nil
+			},
+		},
+	})
+
+	mustRun(t, client, "store", "Seed", testInput{Name: "items", Count: 10})
+
+	var out []any
+	mustOutput(t, runService(client, "store", "Batch", testInput{}), &out)
+	// the duplicate fails on its own, 3 documents are renamed and 3 of the 12 deleted
+	if fmt.Sprint(out) != "[[items/item-000] 3 3 3 9]" {
+		t.Fatalf("unexpected batch results %v", out)
+	}
+}
+
+func TestCollection_InsertManyLeavesTheCallerOptions(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Batch": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				// options with spare capacity must not be appended to in place
+				opts := make([]sdk.WriteOption, 1, 2)
+				opts[0] = sdk.WithUpsert()
+
+				results, err := ctx.Db().Get().ServiceCollection("items").InsertMany([]sdk.InsertItem{
+					{Id: "a", Item: &testItem{Name: "a"}, Opts: []sdk.WriteOption{sdk.WithExpireIn(time.Hour)}},
+					{Id: "b", Item: &testItem{Name: "b"}, Opts: []sdk.WriteOption{sdk.WithExpireIn(time.Hour)}},
+				}, opts...)
+				if err != nil {
+					return nil, err
+				}
+				return []any{len(results), opts[:cap(opts)][1] == nil}, nil
+			},
+		},
+	})
+
+	var out []any
+	mustOutput(t, runService(client, "store", "Batch", testInput{}), &out)
+	if fmt.Sprint(out) != "[2 true]" {
+		t.Fatalf("expected both items inserted with the caller options untouched, got %v", out)
+	}
+}
+
+func TestTypedCollection_RoundTrip(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Typed": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				collection := ctx.Db().Get().ServiceCollection("items")
+				_, err := sdk.NewTypedCollection[testInput](collection)
+				if err == nil {
+					return nil, fmt.Errorf("expected a type mismatch for testInput")
+				}
+
+				items, err := sdk.NewTypedCollection[testItem](collection)
+				if err != nil {
+					return nil, err
+				}
+				for i, name := range []string{"a", "b", "c"} {
+					_, err = items.InsertOne(name, testItem{Name: name, Count: i})
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				updated, err := items.UpdateWithRetry("b", func(current *testItem) error {
+					current.Count += 10
+					return nil
+				}, 3)
+				if err != nil {
+					return nil, err
+				}
+
+				item, version, err := items.GetOne("b")
+				if err != nil {
+					return nil, err
+				}
+				if item != updated || version != 2 {
+					return nil, fmt.Errorf("expected %+v at version 2, got %+v at %d", updated, item, version)
+				}
+
+				return items.Query().Filter("count > ?", 0).OrderBy("count", sdk.SortAsc).GetAll(ctx)
+			},
+		},
+	})
+
+	err := GetModelRegistry("store").Register("items", &testItem{})
+	if err != nil {
+		t.Fatalf("failed to register model: %s", err.Error())
+	}
+	startTestApp(t, client)
+
+	var items []testItem
+	mustOutput(t, runService(client, "store", "Typed", testInput{}), &items)
+	if fmt.Sprint(items) != "[{c 2} {b 11}]" {
+		t.Fatalf("unexpected typed query result %v", items)
+	}
+}
+
+// watchService is a testService whose OnChange method receives the change events of watched collections
+type watchService struct {
+	*testService
+	events []sdk.ChangeEvent
+}
+
+func (s *watchService) GetInputType(method string) (any, error) {
+	if method == "OnChange" {
+		return &sdk.ChangeEvent{}, nil
+	}
+	return s.testService.GetInputType(method)
+}
+
+func (s *watchService) ExecuteService(ctx sdk.ServiceContext, method string, input any) (any, error) {
+	if method == "OnChange" {
+		s.events = append(s.events, *input.(*sdk.ChangeEvent))
+		return nil, nil
+	}
+	if method == "@definition" {
+		methods, err := s.testService.ExecuteService(ctx, method, input)
+		return append(methods.([]string), "OnChange"), err
+	}
+	return s.testService.ExecuteService(ctx, method, input)
+}
+
+func TestWatch_DeliversChanges(t *testing.T) {
+	service := &watchService{testService: &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Write": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				items := ctx.Db().Get().ServiceCollection("items")
+				doc, err := items.InsertOne("a", &testItem{Name: "a"})
+				if err != nil {
+					return nil, err
+				}
+				err = doc.Update(&testItem{Name: "a", Count: 1})
+				if err != nil {
+					return nil, err
+				}
+				err = doc.Delete()
+				if err != nil {
+					return nil, err
+				}
+
+				// changes of collections nobody watches are not delivered
+				_, err = ctx.Db().Get().ServiceCollection("other").InsertOne("a", &testItem{Name: "a"})
+				return nil, err
+			},
+		},
+	}}
+	client := newTestClient(t, service)
+
+	registry := GetModelRegistry("store")
+	err := registry.Register("items", &testItem{})
+	if err != nil {
+		t.Fatalf("failed to register model: %s", err.Error())
+	}
+	err = registry.Watch("items", "OnChange")
+	if err != nil {
+		t.Fatalf("failed to watch items: %s", err.Error())
+	}
+	startTestApp(t, client)
+
+	mustRun(t, client, "store", "Write", testInput{})
+
+	var changes []string
+	for _, event := range service.events {
+		changes = append(changes, fmt.Sprintf("%s %s v%d %v", event.Type, event.Path, event.Version, event.NewData["count"]))
+	}
+	if fmt.Sprint(changes) != "[insert items/a v1 0 update items/a v2 1 delete items/a v2 <nil>]" {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+}
+
+func TestWatch_ReplayedWritesAreNotDeliveredAgain(t *testing.T) {
+	service := &watchService{testService: &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Write": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				items := ctx.Db().Get().ServiceCollection("items")
+				doc, err := items.InsertOne("a", &testItem{Name: "a"}, sdk.WithUpsert())
+				if err != nil {
+					return nil, err
+				}
+
+				// the handler halts, so the insert is made again when it is replayed
+				err = ctx.(sdk.WorkflowContext).Sleep(time.Minute)
+				if err != nil {
+					return nil, err
+				}
+				return nil, doc.Update(&testItem{Name: "a", Count: 1})
+			},
+		},
+	}}
+	client := newTestClient(t, service)
+
+	registry := GetModelRegistry("store")
+	err := registry.Register("items", &testItem{})
+	if err != nil {
+		t.Fatalf("failed to register model: %s", err.Error())
+	}
+	err = registry.Watch("items", "OnChange")
+	if err != nil {
+		t.Fatalf("failed to watch items: %s", err.Error())
+	}
+	startTestApp(t, client)
+
+	runService(client, "store", "Write", testInput{})
+	client.Advance(time.Minute)
+	client.RunPending(context.Background())
+
+	// the insert runs again on the replay and moves the version, but only the update is new
+	var changes []string
+	for _, event := range service.events {
+		changes = append(changes, fmt.Sprintf("%s %s v%d %v", event.Type, event.Path, event.Version, event.NewData["count"]))
+	}
+	if fmt.Sprint(changes) != "[insert items/a v1 0 update items/a v3 1]" {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+}
+
+func TestQuery_Where(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Seed": seedHandler,
+			"Find": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				items := ctx.Db().Get().ServiceCollection("items")
+				condition := sdk.F("count").Gte(2).And(sdk.F("count").Lt(5)).
+					Or(sdk.F("name").In("item-008", "item-009")).
+					And(sdk.Not(sdk.F("count").Eq(3)))
+
+				docs, err := items.Query().Where(condition).OrderBy("count", sdk.SortAsc).GetAll(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				_, err = items.Query().Where(sdk.F("colour").Eq("red")).GetAll(ctx)
+				var validationErr sdk.ValidationError
+				if !errors.As(err, &validationErr) {
+					return nil, fmt.Errorf("expected an unknown field to fail the query, got %v", err)
+				}
+
+				var names []string
+				for _, doc := range docs {
+					var item testItem
+					err = doc.Unmarshal(&item)
+					if err != nil {
+						return nil, err
+					}
+					names = append(names, item.Name)
+				}
+				return names, nil
+			},
+		},
+	})
+
+	err := GetModelRegistry("store").Register("items", &testItem{})
+	if err != nil {
+		t.Fatalf("failed to register model: %s", err.Error())
+	}
+	startTestApp(t, client)
+
+	mustRun(t, client, "store", "Seed", testInput{Name: "items", Count: 10})
+
+	var names []string
+	mustOutput(t, runService(client, "store", "Find", testInput{}), &names)
+	if fmt.Sprint(names) != "[item-002 item-004 item-008 item-009]" {
+		t.Fatalf("unexpected matches %v", names)
+	}
+}
+
+func TestQuery_EmptyConditions(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Seed": seedHandler,
+			"Find": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				// a condition built up from the zero value, with empty parts left out
+				var condition sdk.Condition
+				for _, count := range []int{1, 3} {
+					condition = condition.Or(sdk.F("count").Eq(count))
+				}
+				condition = condition.And(sdk.Not(sdk.Condition{})).Or(sdk.Condition{}.And(sdk.Condition{}))
+
+				var counts []int
+				for _, c := range []sdk.Condition{sdk.Not(sdk.Condition{}), sdk.Condition{}.Or(sdk.Condition{}), condition} {
+					n, err := ctx.Db().Get().ServiceCollection("items").Query().Where(c).Count(ctx)
+					if err != nil {
+						return nil, fmt.Errorf("query %q failed: %w", c.Expr(), err)
+					}
+					counts = append(counts, int(n))
+				}
+				return counts, nil
+			},
+		},
+	})
+
+	err := GetModelRegistry("store").Register("items", &testItem{})
+	if err != nil {
+		t.Fatalf("failed to register model: %s", err.Error())
+	}
+	startTestApp(t, client)
+
+	mustRun(t, client, "store", "Seed", testInput{Name: "items", Count: 5})
+
+	var counts []int
+	mustOutput(t, runService(client, "store", "Find", testInput{}), &counts)
+	if fmt.Sprint(counts) != "[5 5 2]" {
+		t.Fatalf("expected empty conditions to match every document, got %v", counts)
+	}
+}
+
+func TestCollection_UpdateWithRetry(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Seed": seedHandler,
+			"Bump": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				items := ctx.Db().Get().ServiceCollection("items")
+
+				// every attempt up to input.Count races with another writer
+				attempts := 0
+				var count float64
+				err := items.UpdateWithRetry("item-001", func(current map[string]interface{}) error {
+					attempts++
+					if attempts <= input.Count {
+						doc, err := items.GetOne("item-001")
+						if err != nil {
+							return err
+						}
+						err = doc.Update(&testItem{Name: "item-001", Count: 100 * attempts})
+						if err != nil {
+							return err
+						}
+					}
+
+					count = current["count"].(float64) + 1
+					current["count"] = count
+					return nil
+				}, 3)
+				return []any{attempts, count, errors.Is(err, sdk.ErrConflict) || sdk.IsError(err, sdk.ErrConflict)}, nil
+			},
+		},
+	})
+
+	mustRun(t, client, "store", "Seed", testInput{Name: "items", Count: 2})
+
+	var out []any
+	mustOutput(t, runService(client, "store", "Bump", testInput{Count: 1}), &out)
+	if fmt.Sprint(out) != "[2 101 false]" {
+		t.Fatalf("expected to succeed on the second attempt on top of the concurrent write, got %v", out)
+	}
+
+	mustOutput(t, runService(client, "store", "Bump", testInput{Count: 3}), &out)
+	if fmt.Sprint(out) != "[3 201 true]" {
+		t.Fatalf("expected a conflict after 3 attempts, got %v", out)
+	}
+}
+
+func TestDoc_VersionAndTimestamps(t *testing.T) {
+	type docInfo struct {
+		Version   int64     `json:"version"`
+		CreatedAt time.Time `json:"createdAt"`
+		UpdatedAt time.Time `json:"updatedAt"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+	info := func(doc sdk.Doc) docInfo {
+		return docInfo{Version: doc.Version(), CreatedAt: doc.CreatedAt(), UpdatedAt: doc.UpdatedAt(), ExpiresAt: doc.ExpiresAt()}
+	}
+
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Insert": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				doc, err := ctx.Db().Get().ServiceCollection("items").InsertOne("a", &testItem{Name: "a"})
+				if err != nil {
+					return nil, err
+				}
+				return info(doc), nil
+			},
+			"Touch": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				items := ctx.Db().Get().ServiceCollection("items")
+				doc, err := items.GetOne("a")
+				if err != nil {
+					return nil, err
+				}
+				stale, err := items.GetOne("a")
+				if err != nil {
+					return nil, err
+				}
+
+				err = doc.Update(&testItem{Name: "a", Count: 1})
+				if err != nil {
+					return nil, err
+				}
+				err = doc.ExpireIn(time.Hour)
+				if err != nil {
+					return nil, err
+				}
+
+				err = stale.Refresh()
+				if err != nil {
+					return nil, err
+				}
+				if info(stale) != info(doc) {
+					return nil, fmt.Errorf("refreshed doc %+v differs from the written one %+v", info(stale), info(doc))
+				}
+
+				err = doc.Delete()
+				if err != nil {
+					return nil, err
+				}
+				if err = stale.Refresh(); !sdk.IsError(err, *sdk.ErrNotFound) {
+					return nil, fmt.Errorf("expected a deleted doc to be not found, got %v", err)
+				}
+				return info(doc), nil
+			},
+		},
+	})
+
+	var inserted, touched docInfo
+	mustOutput(t, runService(client, "store", "Insert", testInput{}), &inserted)
+	client.Advance(time.Minute)
+	mustOutput(t, runService(client, "store", "Touch", testInput{}), &touched)
+
+	if inserted.Version != 1 || inserted.CreatedAt.IsZero() || !inserted.UpdatedAt.Equal(inserted.CreatedAt) || !inserted.ExpiresAt.IsZero() {
+		t.Fatalf("unexpected inserted doc %+v", inserted)
+	}
+	if touched.Version != 3 || !touched.CreatedAt.Equal(inserted.CreatedAt) {
+		t.Fatalf("unexpected touched doc %+v", touched)
+	}
+	if touched.UpdatedAt.Sub(inserted.UpdatedAt) < time.Minute || touched.ExpiresAt.Sub(touched.UpdatedAt)-time.Hour > time.Second {
+		t.Fatalf("unexpected timestamps after the update %+v", touched)
+	}
+}
@@ -0,0 +1,63 @@
+package runtime
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+)
+
+// Now returns the current time, recorded on first execution so replays see the same value.
+func (c Context) Now() (time.Time, error) {
+	var now time.Time
+	err := c.Memo(func() (any, error) {
+		return time.Now(), nil
+	}).Get(&now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return now, nil
+}
+
+// Random returns size random bytes, recorded on first execution so replays see the same value.
+func (c Context) Random(size int) ([]byte, error) {
+	var data []byte
+	err := c.Memo(func() (any, error) {
+		return randomBytes(size)
+	}).Get(&data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// UUID returns a random (version 4) uuid, recorded on first execution so replays see the same value.
+func (c Context) UUID() (string, error) {
+	var id string
+	err := c.Memo(func() (any, error) {
+		return newUUID()
+	}).Get(&id)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func randomBytes(size int) ([]byte, error) {
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func newUUID() (string, error) {
+	b, err := randomBytes(16)
+	if err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
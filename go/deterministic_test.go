@@ -0,0 +1,59 @@
+package runtime
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+func TestDeterministic_ValuesSurviveReplay(t *testing.T) {
+	type values struct {
+		now    time.Time
+		random string
+		uuid   string
+	}
+
+	var runs []values
+	client := newTestClient(t, &testService{
+		name: "clock",
+		workflows: map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error){
+			"Run": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				now, err := ctx.Now()
+				if err != nil {
+					return nil, err
+				}
+				random, err := ctx.Random(8)
+				if err != nil {
+					return nil, err
+				}
+				uuid, err := ctx.UUID()
+				if err != nil {
+					return nil, err
+				}
+
+				runs = append(runs, values{now: now, random: string(random), uuid: uuid})
+				return nil, ctx.Sleep(time.Minute)
+			},
+		},
+	})
+
+	runService(client, "clock", "Run", testInput{})
+	client.Advance(time.Minute)
+	client.RunPending(context.Background())
+
+	if len(runs) != 2 {
+		t.Fatalf("expected the workflow to run twice, ran %d times", len(runs))
+	}
+	if !runs[0].now.Equal(runs[1].now) || runs[0].random != runs[1].random || runs[0].uuid != runs[1].uuid {
+		t.Fatalf("replay saw different values %+v and %+v", runs[0], runs[1])
+	}
+	if len(runs[0].random) != 8 {
+		t.Fatalf("expected 8 random bytes, got %d", len(runs[0].random))
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(runs[0].uuid) {
+		t.Fatalf("not a version 4 uuid %s", runs[0].uuid)
+	}
+}
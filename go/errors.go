@@ -8,3 +8,4 @@ var ErrServiceExecError = sdk.DefineError("sdk.client", 3, "service exec error")
 var ErrApiExecError = sdk.DefineError("sdk.client", 4, "api exec error")
 var ErrBadRequest = sdk.DefineError("sdk.client", 5, "bad request")
 var ErrTaskExecError = sdk.DefineError("sdk.client", 6, "task execution error")
+var ErrNonDeterministic = sdk.DefineError("sdk.client", 7, "non-deterministic workflow, step %d recorded as %s but replayed as %s")
@@ -0,0 +1,67 @@
+package runtime
+
+import (
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+type Future struct {
+	sessionId     string
+	callId        string
+	serviceClient ServiceClient
+}
+
+func (f *Future) CallId() string {
+	return f.callId
+}
+
+func (f *Future) Await() (sdk.Response, error) {
+	responses, err := awaitFutures(f.serviceClient, f.sessionId, []sdk.Future{f}, false)
+	if err != nil {
+		return nil, err
+	}
+	return responses[0], nil
+}
+
+var _ sdk.Future = (*Future)(nil)
+
+// awaitFutures waits until all (or with any, at least one) of the calls complete. The task halts
+// while they are pending and responses of calls that have not completed are left nil.
+// Nothing is awaited for an empty list, so it returns right away.
+func awaitFutures(client ServiceClient, sessionId string, futures []sdk.Future, waitAny bool) ([]sdk.Response, error) {
+	if len(futures) == 0 {
+		return []sdk.Response{}, nil
+	}
+
+	req := AwaitCallsRequest{
+		CallIds: make([]string, 0, len(futures)),
+		Any:     waitAny,
+	}
+	for _, future := range futures {
+		req.CallIds = append(req.CallIds, future.CallId())
+	}
+
+	output, err := client.AwaitCalls(sessionId, req)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]AsyncCallResult)
+	for _, result := range output.Results {
+		results[result.CallId] = result
+	}
+
+	responses := make([]sdk.Response, len(futures))
+	for i, callId := range req.CallIds {
+		result, ok := results[callId]
+		if !ok || !result.IsCompleted {
+			continue
+		}
+
+		responses[i] = &Response{
+			output:  result.Output,
+			isError: result.IsError,
+			error:   result.Error,
+		}
+	}
+	return responses, nil
+}
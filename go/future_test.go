@@ -0,0 +1,139 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+func TestAwaitAll_WithoutFutures(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "fan",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Double": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				return input.Count * 2, nil
+			},
+		},
+		workflows: map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error){
+			"Sum": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				var futures []sdk.Future
+				for i := 1; i <= input.Count; i++ {
+					future, err := ctx.Service("fan").Get().Async(sdk.TaskOptions{}, "Double", testInput{Count: i})
+					if err != nil {
+						return nil, err
+					}
+					futures = append(futures, future)
+				}
+
+				responses, err := ctx.AwaitAll(futures...)
+				if err != nil {
+					return nil, err
+				}
+
+				sum := 0
+				for _, res := range responses {
+					var doubled int
+					err = res.Get(&doubled)
+					if err != nil {
+						return nil, err
+					}
+					sum += doubled
+				}
+				return sum, nil
+			},
+		},
+	})
+
+	for count, expected := range map[int]int{0: 0, 3: 12} {
+		evt := runService(client, "fan", "Sum", testInput{Count: count})
+		if evt.Output == nil && !evt.IsError {
+			t.Fatalf("awaiting %d futures did not complete", count)
+		}
+
+		var sum int
+		mustOutput(t, evt, &sum)
+		if sum != expected {
+			t.Fatalf("expected %d for %d futures, got %d", expected, count, sum)
+		}
+	}
+}
+
+func TestAwaitAny_ReplaysTheFirstCompletedCall(t *testing.T) {
+	var winners []int
+	client := newTestClient(t, &testService{
+		name: "fan",
+		workflows: map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error){
+			"Slow": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				err := ctx.Sleep(time.Duration(input.Count) * time.Minute)
+				return input.Count * 10, err
+			},
+			"FanOut": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				var futures []sdk.Future
+				for _, minutes := range []int{3, 1, 2} {
+					future, err := ctx.Service("fan").Get().Async(sdk.TaskOptions{}, "Slow", testInput{Count: minutes})
+					if err != nil {
+						return nil, err
+					}
+					futures = append(futures, future)
+				}
+
+				winner, _, err := ctx.AwaitAny(futures...)
+				if err != nil {
+					return nil, err
+				}
+				winners = append(winners, winner)
+
+				responses, err := ctx.AwaitAll(futures...)
+				if err != nil {
+					return nil, err
+				}
+
+				var values []int
+				for _, res := range responses {
+					var value int
+					err = res.Get(&value)
+					if err != nil {
+						return nil, err
+					}
+					values = append(values, value)
+				}
+				return values, nil
+			},
+		},
+	})
+
+	client.RunService(context.Background(), ServiceStartEvent{SessionId: "fan-out", Service: "fan", Method: "FanOut", Input: testInput{}})
+	if _, ok := client.TaskResult("fan-out"); ok || len(winners) != 0 {
+		t.Fatalf("expected the workflow to halt until a call completes, winners %v", winners)
+	}
+
+	client.Advance(time.Minute)
+	client.RunPending(context.Background())
+	if _, ok := client.TaskResult("fan-out"); ok || fmt.Sprint(winners) != "[1]" {
+		t.Fatalf("expected the second call to win and the workflow to wait for the rest, winners %v", winners)
+	}
+
+	client.Advance(2 * time.Minute)
+	client.RunPending(context.Background())
+
+	evt, ok := client.TaskResult("fan-out")
+	if !ok {
+		t.Fatal("workflow did not complete after all calls did")
+	}
+	var values []int
+	mustOutput(t, evt, &values)
+	if fmt.Sprint(values) != "[30 10 20]" {
+		t.Fatalf("expected the responses in the order of the calls, got %v", values)
+	}
+	if len(winners) < 2 {
+		t.Fatalf("expected AwaitAny to be replayed, winners %v", winners)
+	}
+	for _, winner := range winners {
+		if winner != 1 {
+			t.Fatalf("replays returned another winner %v", winners)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package runtime
+
+import (
+	"fmt"
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+	"reflect"
+	"strings"
+)
+
+// WithIndex declares an index on fields, more than one field makes a composite index
+func WithIndex(name string, fields ...string) RegisterOption {
+	return func(cfg *RegisterConfig) {
+		cfg.indexes = append(cfg.indexes, sdk.IndexDescription{
+			Name:   name,
+			Fields: fields,
+		})
+	}
+}
+
+// WithUniqueIndex declares an index on fields that rejects two documents with the same values.
+// The runtime only describes the index, the sidecar enforces it when documents are written.
+func WithUniqueIndex(name string, fields ...string) RegisterOption {
+	return func(cfg *RegisterConfig) {
+		cfg.indexes = append(cfg.indexes, sdk.IndexDescription{
+			Name:   name,
+			Fields: fields,
+			Unique: true,
+		})
+	}
+}
+
+// tagIndexes reads the index struct tags of a model. `index:""` indexes the field on its own,
+// `index:"name"` adds the field to the named index in field order and `index:"name,unique"`
+// makes the index unique.
+func tagIndexes(modelType interface{}) ([]sdk.IndexDescription, error) {
+	t := reflect.Indirect(reflect.ValueOf(modelType)).Type()
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	var indexes []sdk.IndexDescription
+	positions := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("index")
+		if !ok {
+			continue
+		}
+
+		fieldName := jsonFieldName(field)
+		if fieldName == "" {
+			return nil, fmt.Errorf("index on field %s that is not stored", field.Name)
+		}
+
+		name, flag, _ := strings.Cut(tag, ",")
+		if flag != "" && flag != "unique" {
+			return nil, fmt.Errorf("invalid index option %s on field %s", flag, field.Name)
+		}
+		if name == "" {
+			name = fieldName
+		}
+
+		pos, ok := positions[name]
+		if !ok {
+			pos = len(indexes)
+			positions[name] = pos
+			indexes = append(indexes, sdk.IndexDescription{
+				Name: name,
+			})
+		}
+		indexes[pos].Fields = append(indexes[pos].Fields, fieldName)
+		indexes[pos].Unique = indexes[pos].Unique || flag == "unique"
+	}
+	return indexes, nil
+}
+
+func validateIndexes(modelType interface{}, indexes []sdk.IndexDescription) error {
+	t := reflect.Indirect(reflect.ValueOf(modelType)).Type()
+
+	names := make(map[string]bool)
+	for _, index := range indexes {
+		if index.Name == "" || len(index.Fields) == 0 {
+			return fmt.Errorf("index must have a name and at least one field")
+		}
+		if names[index.Name] {
+			return fmt.Errorf("index %s declared twice", index.Name)
+		}
+		names[index.Name] = true
+
+		if t.Kind() != reflect.Struct {
+			continue
+		}
+		for _, path := range index.Fields {
+			if !hasJsonField(t, path) {
+				return fmt.Errorf("index %s refers to unknown field %s", index.Name, path)
+			}
+		}
+	}
+	return nil
+}
+
+// jsonFieldName returns the name a struct field is stored under, empty when it is not stored
+func jsonFieldName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	} else if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// hasJsonField checks that a dot separated path resolves to a stored field of t
+func hasJsonField(t reflect.Type, path string) bool {
+	for _, part := range strings.Split(path, ".") {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return false
+		}
+
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			if jsonFieldName(t.Field(i)) == part {
+				t = t.Field(i).Type
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
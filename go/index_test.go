@@ -0,0 +1,149 @@
+package runtime
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+type testAccount struct {
+	Email string `json:"email" index:"email,unique"`
+	Team  string `json:"team" index:"team_role"`
+	Role  string `json:"role" index:"team_role"`
+}
+
+func TestIndexes_DeclaredAndEnforced(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "accounts",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Add": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				_, err := ctx.Db().Get().ServiceCollection("accounts").InsertOne(fmt.Sprint(input.Count), &testAccount{
+					Email: input.Name,
+					Team:  "core",
+					Role:  "dev",
+				})
+				return nil, err
+			},
+		},
+	})
+
+	registry := GetModelRegistry("accounts")
+	err := registry.Register("accounts", &testAccount{}, WithIndex("by_role", "role"))
+	if err != nil {
+		t.Fatalf("failed to register model: %s", err.Error())
+	}
+	err = registry.Register("broken", &testAccount{}, WithIndex("by_missing", "missing"))
+	if err == nil {
+		t.Fatal("expected an index on an unknown field to be rejected")
+	}
+	startTestApp(t, client)
+
+	var declared []string
+	for _, index := range registry.Get("accounts").Indexes {
+		declared = append(declared, fmt.Sprintf("%s%v unique=%v", index.Name, index.Fields, index.Unique))
+	}
+	if fmt.Sprint(declared) != "[email[email] unique=true team_role[team role] unique=false by_role[role] unique=false]" {
+		t.Fatalf("unexpected indexes %v", declared)
+	}
+
+	mustRun(t, client, "accounts", "Add", testInput{Name: "a@example.com", Count: 1})
+	mustRun(t, client, "accounts", "Add", testInput{Name: "b@example.com", Count: 2})
+	evt := runService(client, "accounts", "Add", testInput{Name: "a@example.com", Count: 3})
+	if !evt.IsError {
+		t.Fatal("expected a duplicate email to be rejected by the unique index")
+	}
+}
+
+func TestIndexes_UniqueValuesAreReleased(t *testing.T) {
+	accounts := func(ctx sdk.ServiceContext) sdk.Collection {
+		return ctx.Db().Get().ServiceCollection("accounts")
+	}
+
+	client := newTestClient(t, &testService{
+		name: "accounts",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Add": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				_, err := accounts(ctx).InsertOne(fmt.Sprint(input.Count), &testAccount{Email: input.Name})
+				return nil, err
+			},
+			"AddExpiring": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				_, err := accounts(ctx).InsertOne(fmt.Sprint(input.Count), &testAccount{Email: input.Name}, sdk.WithExpireIn(time.Minute))
+				return nil, err
+			},
+			"Rename": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				doc, err := accounts(ctx).GetOne(fmt.Sprint(input.Count))
+				if err != nil {
+					return nil, err
+				}
+				return nil, doc.Update(&testAccount{Email: input.Name})
+			},
+			"Remove": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				doc, err := accounts(ctx).GetOne(fmt.Sprint(input.Count))
+				if err != nil {
+					return nil, err
+				}
+				return nil, doc.Delete()
+			},
+			"RenameAndFail": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				err := ctx.Db().Get().Transaction(func(tx sdk.DataStore) error {
+					doc, err := tx.ServiceCollection("accounts").GetOne(fmt.Sprint(input.Count))
+					if err != nil {
+						return err
+					}
+					err = doc.Update(&testAccount{Email: input.Name})
+					if err != nil {
+						return err
+					}
+
+					// the account inserted after the rename exists, so the commit is rolled back
+					_, err = tx.ServiceCollection("accounts").InsertOne("1", &testAccount{})
+					return err
+				})
+				if !sdk.IsError(err, sdk.ErrAlreadyExist) {
+					return nil, fmt.Errorf("expected the commit to fail, got %v", err)
+				}
+				return nil, nil
+			},
+		},
+	})
+
+	err := GetModelRegistry("accounts").Register("accounts", &testAccount{})
+	if err != nil {
+		t.Fatalf("failed to register model: %s", err.Error())
+	}
+	startTestApp(t, client)
+
+	// added reports whether account id could be written with email
+	added := func(method string, id int, email string) bool {
+		return !runService(client, "accounts", method, testInput{Name: email, Count: id}).IsError
+	}
+
+	mustRun(t, client, "accounts", "Add", testInput{Name: "a@example.com", Count: 1})
+	mustRun(t, client, "accounts", "Add", testInput{Name: "b@example.com", Count: 2})
+	if added("Rename", 2, "a@example.com") {
+		t.Fatal("expected a rename to a taken email to be rejected")
+	}
+
+	mustRun(t, client, "accounts", "Remove", testInput{Count: 1})
+	if !added("Add", 3, "a@example.com") {
+		t.Fatal("expected the email of a deleted account to be released")
+	}
+
+	mustRun(t, client, "accounts", "Rename", testInput{Name: "c@example.com", Count: 3})
+	if !added("Add", 1, "a@example.com") {
+		t.Fatal("expected the old email of a renamed account to be released")
+	}
+
+	mustRun(t, client, "accounts", "AddExpiring", testInput{Name: "x@example.com", Count: 4})
+	client.Advance(2 * time.Minute)
+	if !added("Add", 5, "x@example.com") {
+		t.Fatal("expected the email of an expired account to be released")
+	}
+
+	mustRun(t, client, "accounts", "RenameAndFail", testInput{Name: "d@example.com", Count: 1})
+	if added("Add", 6, "a@example.com") || !added("Add", 7, "d@example.com") {
+		t.Fatal("expected a rolled back rename to keep the old email and release the new one")
+	}
+}
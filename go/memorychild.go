@@ -0,0 +1,156 @@
+package runtime
+
+import (
+	"fmt"
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+func (m *MemoryServiceClient) StartChild(sessionId string, req ExecServiceRequest) (StartChildResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task := m.getTask(sessionId)
+	step, err := m.replayStep(task, "child")
+	if err != nil {
+		return StartChildResponse{}, err
+	}
+
+	if step == nil {
+		step = m.startAsyncChild(task, "child", req)
+	}
+
+	task.Cursor++
+	return StartChildResponse{
+		TaskId: m.state.Tasks[step.Child].taskId(),
+		CallId: fmt.Sprint(step.Output),
+	}, nil
+}
+
+func (m *MemoryServiceClient) GetChildStatus(sessionId string, req ChildRequest) (ChildStatusResponse, error) {
+	step, err := m.childCommand(sessionId, "status", req, func(child *memoryTask) any {
+		return child.status()
+	})
+	if err != nil {
+		return ChildStatusResponse{}, err
+	}
+
+	return ChildStatusResponse{
+		Status: sdk.TaskStatus(fmt.Sprint(step.Output)),
+	}, nil
+}
+
+func (m *MemoryServiceClient) CancelChild(sessionId string, req ChildRequest) error {
+	_, err := m.childCommand(sessionId, "cancel", req, func(child *memoryTask) any {
+		m.cancelTask(child)
+		return nil
+	})
+	return err
+}
+
+func (m *MemoryServiceClient) DetachChild(sessionId string, req ChildRequest) error {
+	_, err := m.childCommand(sessionId, "detach", req, func(child *memoryTask) any {
+		child.Detached = true
+		return nil
+	})
+	return err
+}
+
+// childCommand journals an operation on a child task so it only takes effect on first execution.
+func (m *MemoryServiceClient) childCommand(sessionId string, kind string, req ChildRequest, fn func(child *memoryTask) any) (memoryStep, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task := m.getTask(sessionId)
+	step, err := m.replayStep(task, kind)
+	if err != nil {
+		return memoryStep{}, err
+	}
+
+	if step == nil {
+		child := m.findTask(req.TaskId)
+		if child == nil || child.Parent != task.SessionId {
+			return memoryStep{}, ErrBadRequest.Wrap(fmt.Errorf("task %s is not a child of %s", req.TaskId, task.taskId()))
+		}
+
+		step = m.recordStep(task, memoryStep{
+			Kind:      kind,
+			Completed: true,
+			Output:    fn(child),
+			Child:     child.SessionId,
+		})
+	}
+
+	task.Cursor++
+	return *step, nil
+}
+
+func (t *memoryTask) status() sdk.TaskStatus {
+	if t.Status != memoryTaskCompleted {
+		return sdk.TaskStatusRunning
+	} else if t.Cancelled {
+		return sdk.TaskStatusCancelled
+	} else if t.ServiceResult != nil && t.ServiceResult.IsError {
+		return sdk.TaskStatusFailed
+	}
+	return sdk.TaskStatusCompleted
+}
+
+// CancelTask cancels a service task and its attached children. Tasks executing right now have
+// their context cancelled through the listener, halted ones are replayed with a cancelled context
+// so cleanup and compensation code runs before they complete as cancelled.
+func (m *MemoryServiceClient) CancelTask(event TaskCancelEvent) error {
+	m.mu.Lock()
+	task := m.findTask(event.TaskId)
+	if task == nil {
+		m.mu.Unlock()
+		return sdk.ErrNotFound
+	}
+
+	m.cancelTask(task)
+
+	var running []string
+	for _, t := range m.state.Tasks {
+		if t.Kind == memoryTaskService && t.Cancelled && t.Status == memoryTaskRunning {
+			running = append(running, t.taskId())
+		}
+	}
+	listener := m.listener
+	m.mu.Unlock()
+
+	if listener == nil {
+		return nil
+	}
+	for _, taskId := range running {
+		err := listener.CancelTask(TaskCancelEvent{TaskId: taskId})
+		if err != nil {
+			fmt.Printf("failed to cancel task %s in flight: %s\n", taskId, err.Error())
+		}
+	}
+	return nil
+}
+
+func (m *MemoryServiceClient) cancelTask(task *memoryTask) {
+	if task.Kind != memoryTaskService || task.Status == memoryTaskCompleted || task.Cancelled {
+		return
+	}
+
+	task.Cancelled = true
+	m.cancelChildren(task)
+
+	// a running task is replayed once it halts
+	m.wake(task.SessionId)
+}
+
+func (m *MemoryServiceClient) cancelChildren(task *memoryTask) {
+	for _, child := range m.state.Tasks {
+		if child.Parent == task.SessionId && !child.Detached {
+			m.cancelTask(child)
+		}
+	}
+}
+
+// closeTask cancels the attached children of a completed task and wakes its parent.
+func (m *MemoryServiceClient) closeTask(task *memoryTask) {
+	m.cancelChildren(task)
+	m.wake(task.Parent)
+}
@@ -0,0 +1,1013 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	memoryTaskService = "service"
+	memoryTaskApi     = "api"
+
+	memoryTaskRunning   = "running"
+	memoryTaskHalted    = "halted"
+	memoryTaskCompleted = "completed"
+
+	memoryPageSize = 100
+)
+
+type memoryStep struct {
+	Kind      string    `json:"kind"`
+	Completed bool      `json:"completed"`
+	Output    any       `json:"output"`
+	IsError   bool      `json:"isError"`
+	Error     sdk.Error `json:"error"`
+	Child     string    `json:"child"`
+	Deadline  time.Time `json:"deadline"`
+	IsTimeout bool      `json:"isTimeout"`
+	ChangeId  string    `json:"changeId"`
+	Version   int       `json:"version"`
+}
+
+type memoryTask struct {
+	SessionId     string                `json:"sessionId"`
+	Kind          string                `json:"kind"`
+	Status        string                `json:"status"`
+	Parent        string                `json:"parent"`
+	Service       ServiceStartEvent     `json:"service"`
+	Api           ApiStartEvent         `json:"api"`
+	ServiceResult *ServiceCompleteEvent `json:"serviceResult"`
+	ApiResult     *ApiCompleteEvent     `json:"apiResult"`
+	Steps         []memoryStep          `json:"steps"`
+	WaitUntil     time.Time             `json:"waitUntil"`
+	Versions      map[string]int        `json:"versions"`
+	Detached      bool                  `json:"detached"`
+	Cancelled     bool                  `json:"cancelled"`
+	Cursor        int                   `json:"-"`
+}
+
+func (t *memoryTask) taskId() string {
+	if t.Kind == memoryTaskApi {
+		return t.Api.Meta.TaskId
+	}
+	return t.Service.Meta.TaskId
+}
+
+func (t *memoryTask) meta() sdk.TaskMeta {
+	if t.Kind == memoryTaskApi {
+		return t.Api.Meta
+	}
+	return t.Service.Meta
+}
+
+type memoryCall struct {
+	Child     string    `json:"child"`
+	Completed bool      `json:"completed"`
+	Output    any       `json:"output"`
+	IsError   bool      `json:"isError"`
+	Error     sdk.Error `json:"error"`
+}
+
+type memoryState struct {
+	Seq       int64                          `json:"seq"`
+	Started   bool                           `json:"started"`
+	App       StartAppRequest                `json:"app"`
+	Tasks     map[string]*memoryTask         `json:"tasks"`
+	Pending   []string                       `json:"pending"`
+	Calls     map[string]*memoryCall         `json:"calls"`
+	Documents map[string]*memoryDocument     `json:"documents"`
+	Files     map[string]*memoryFile         `json:"files"`
+	Locks     map[string]*memoryLock         `json:"locks"`
+	Signals   map[string][]SignalEmitRequest `json:"signals"`
+	Events    []RealtimeEventEmitRequest     `json:"events"`
+}
+
+// MemoryServiceClient is an in-memory ServiceClient that stands in for the sidecar.
+// Attach a runtime to let it execute service and api calls in-process.
+type MemoryServiceClient struct {
+	mu       sync.Mutex
+	saveMu   sync.Mutex
+	state    memoryState
+	listener ApiServerListener
+	clock    func() time.Time
+	changes  []sdk.ChangeEvent
+	// unique maps the values of unique indexes to the key of the document holding them
+	unique map[string]string
+
+	AgentHandler func(req ExecAgentRequest) (ExecAgentResponse, error)
+	AppHandler   func(req ExecAppRequest) (ExecAppResponse, error)
+}
+
+func NewMemoryServiceClient() *MemoryServiceClient {
+	return &MemoryServiceClient{
+		state: memoryState{
+			Tasks:     make(map[string]*memoryTask),
+			Calls:     make(map[string]*memoryCall),
+			Documents: make(map[string]*memoryDocument),
+			Files:     make(map[string]*memoryFile),
+			Locks:     make(map[string]*memoryLock),
+			Signals:   make(map[string][]SignalEmitRequest),
+		},
+		clock:  time.Now,
+		unique: make(map[string]string),
+	}
+}
+
+// Attach sets the runtime used to execute the tasks started through this client.
+func (m *MemoryServiceClient) Attach(listener ApiServerListener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listener = listener
+}
+
+// Advance moves the client clock forward so timers and signal timeouts expire without waiting.
+// Call RunPending afterwards to resume the tasks that became due.
+func (m *MemoryServiceClient) Advance(duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clock := m.clock
+	m.clock = func() time.Time {
+		return clock().Add(duration)
+	}
+}
+
+// Save writes the client state to a json file so it can be restored with Load. Concurrent
+// saves are serialized so the file always holds one complete snapshot.
+func (m *MemoryServiceClient) Save(path string) error {
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	m.mu.Lock()
+	data, err := json.Marshal(m.state)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = tmp.Chmod(0644)
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load restores the client state saved with Save. A missing file leaves the state empty.
+func (m *MemoryServiceClient) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	state := NewMemoryServiceClient().state
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return fmt.Errorf("failed to load state %s: %w", path, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = state
+	m.reindex()
+	return nil
+}
+
+// RunService starts a new service task, runs it along with every task it resumes and returns its completion.
+func (m *MemoryServiceClient) RunService(ctx context.Context, event ServiceStartEvent) ServiceCompleteEvent {
+	m.mu.Lock()
+	task := m.newServiceTask(event, "")
+	m.mu.Unlock()
+
+	m.runTask(ctx, task.SessionId)
+	m.RunPending(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if task.ServiceResult == nil {
+		return ValueToServiceComplete(nil)
+	}
+	return *task.ServiceResult
+}
+
+// RunApi starts a new api task, runs it along with every task it resumes and returns its completion.
+func (m *MemoryServiceClient) RunApi(ctx context.Context, event ApiStartEvent) ApiCompleteEvent {
+	m.mu.Lock()
+	task := m.newApiTask(event, "")
+	m.mu.Unlock()
+
+	m.runTask(ctx, task.SessionId)
+	m.RunPending(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if task.ApiResult == nil {
+		return ApiCompleteEvent{
+			Response: sdk.ApiResponse{
+				StatusCode: 202,
+				Header:     make(map[string]string),
+			},
+		}
+	}
+	return *task.ApiResult
+}
+
+// RunPending resumes halted tasks that became runnable, including those whose timers
+// have expired, until none are left.
+func (m *MemoryServiceClient) RunPending(ctx context.Context) {
+	m.mu.Lock()
+	m.wakeExpired()
+	m.mu.Unlock()
+
+	for {
+		m.mu.Lock()
+		if len(m.state.Pending) == 0 {
+			m.mu.Unlock()
+			return
+		}
+		sessionId := m.state.Pending[0]
+		m.state.Pending = m.state.Pending[1:]
+		m.mu.Unlock()
+
+		m.runTask(ctx, sessionId)
+	}
+}
+
+// TaskResult returns the completion of a finished service task.
+func (m *MemoryServiceClient) TaskResult(sessionId string) (ServiceCompleteEvent, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task := m.state.Tasks[sessionId]
+	if task == nil || task.ServiceResult == nil {
+		return ServiceCompleteEvent{}, false
+	}
+	return *task.ServiceResult, true
+}
+
+// RealtimeEvents returns the events emitted to the given channel.
+func (m *MemoryServiceClient) RealtimeEvents(channel string) []any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []any
+	for _, evt := range m.state.Events {
+		if evt.Channel == channel {
+			events = append(events, evt.Input)
+		}
+	}
+	return events
+}
+
+func (m *MemoryServiceClient) nextId(prefix string) string {
+	m.state.Seq++
+	return fmt.Sprintf("%s-%d", prefix, m.state.Seq)
+}
+
+func (m *MemoryServiceClient) newServiceTask(event ServiceStartEvent, parent string) *memoryTask {
+	if event.SessionId == "" {
+		event.SessionId = m.nextId("session")
+	}
+	if event.Meta.TaskId == "" {
+		event.Meta.TaskId = event.SessionId
+	}
+	if event.Meta.TaskGroup == "" {
+		event.Meta.TaskGroup = event.Service
+	}
+	if event.Meta.TaskName == "" {
+		event.Meta.TaskName = event.Method
+	}
+
+	task := &memoryTask{
+		SessionId: event.SessionId,
+		Kind:      memoryTaskService,
+		Status:    memoryTaskHalted,
+		Parent:    parent,
+		Service:   event,
+	}
+	m.state.Tasks[task.SessionId] = task
+	return task
+}
+
+func (m *MemoryServiceClient) newApiTask(event ApiStartEvent, parent string) *memoryTask {
+	if event.SessionId == "" {
+		event.SessionId = m.nextId("session")
+	}
+	if event.Meta.TaskId == "" {
+		event.Meta.TaskId = event.SessionId
+	}
+
+	task := &memoryTask{
+		SessionId: event.SessionId,
+		Kind:      memoryTaskApi,
+		Status:    memoryTaskHalted,
+		Parent:    parent,
+		Api:       event,
+	}
+	m.state.Tasks[task.SessionId] = task
+	return task
+}
+
+// getTask returns the task of the session, creating a detached one for sessions started outside this client.
+func (m *MemoryServiceClient) getTask(sessionId string) *memoryTask {
+	task := m.state.Tasks[sessionId]
+	if task == nil {
+		task = &memoryTask{
+			SessionId: sessionId,
+			Status:    memoryTaskRunning,
+			Service: ServiceStartEvent{
+				SessionId: sessionId,
+				Meta:      sdk.TaskMeta{TaskId: sessionId},
+			},
+		}
+		m.state.Tasks[sessionId] = task
+	}
+	return task
+}
+
+func (m *MemoryServiceClient) findTask(taskId string) *memoryTask {
+	for _, task := range m.state.Tasks {
+		if task.taskId() == taskId {
+			return task
+		}
+	}
+	return nil
+}
+
+func (m *MemoryServiceClient) runTask(ctx context.Context, sessionId string) {
+	m.mu.Lock()
+	task := m.state.Tasks[sessionId]
+	listener := m.listener
+	if task == nil || listener == nil || task.Status != memoryTaskHalted {
+		m.mu.Unlock()
+		return
+	}
+	task.Status = memoryTaskRunning
+	task.WaitUntil = time.Time{}
+	task.Cursor = 0
+	kind := task.Kind
+	cancelled := task.Cancelled
+	serviceEvent := task.Service
+	serviceEvent.Cancelled = cancelled
+	apiEvent := task.Api
+	m.mu.Unlock()
+
+	var serviceResult ServiceCompleteEvent
+	var apiResult ApiCompleteEvent
+	if kind == memoryTaskApi {
+		apiResult = listener.RunApi(ctx, apiEvent)
+	} else {
+		serviceResult = listener.RunService(ctx, serviceEvent)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if task.Status == memoryTaskHalted {
+		// cancelled while running, replay it with a cancelled context
+		if task.Cancelled && !cancelled {
+			m.wake(task.SessionId)
+		}
+		return
+	}
+
+	task.Status = memoryTaskCompleted
+	if kind == memoryTaskApi {
+		task.ApiResult = &apiResult
+	} else {
+		task.ServiceResult = &serviceResult
+	}
+	m.closeTask(task)
+}
+
+// wake queues a halted task so RunPending replays it.
+func (m *MemoryServiceClient) wake(sessionId string) {
+	task := m.state.Tasks[sessionId]
+	if task == nil || task.Status != memoryTaskHalted {
+		return
+	}
+	for _, pending := range m.state.Pending {
+		if pending == sessionId {
+			return
+		}
+	}
+	m.state.Pending = append(m.state.Pending, sessionId)
+}
+
+// wakeExpired queues halted tasks whose wait deadline has passed.
+func (m *MemoryServiceClient) wakeExpired() {
+	now := m.clock()
+	for _, task := range m.state.Tasks {
+		if task.Status == memoryTaskHalted && !task.WaitUntil.IsZero() && !now.Before(task.WaitUntil) {
+			m.wake(task.SessionId)
+		}
+	}
+}
+
+// suspend marks the task halted and stops its execution the same way a 202 from the sidecar does.
+func (m *MemoryServiceClient) suspend(task *memoryTask) {
+	task.Status = memoryTaskHalted
+	panic(HaltExecution)
+}
+
+// interrupt ends a wait of a cancelled task instead of suspending it. The step keeps the
+// cancellation so replays return the same error.
+func (m *MemoryServiceClient) interrupt(task *memoryTask, step *memoryStep) bool {
+	if !task.Cancelled {
+		return false
+	}
+
+	step.IsError = true
+	step.Error = sdk.ErrTaskCancelled.With(task.taskId())
+	return true
+}
+
+// replayStep returns the journaled step at the task cursor, or nil when execution has gone past the journal.
+func (m *MemoryServiceClient) replayStep(task *memoryTask, kind string) (*memoryStep, error) {
+	if task.Cursor >= len(task.Steps) {
+		return nil, nil
+	}
+
+	step := &task.Steps[task.Cursor]
+	if step.Kind != kind {
+		return nil, ErrNonDeterministic.With(task.Cursor, step.Kind, kind)
+	}
+	return step, nil
+}
+
+func (m *MemoryServiceClient) recordStep(task *memoryTask, step memoryStep) *memoryStep {
+	task.Steps = append(task.Steps, step)
+	return &task.Steps[len(task.Steps)-1]
+}
+
+// awaitChild resolves a step bound to a child task, suspending the caller while the child is still running.
+func (m *MemoryServiceClient) awaitChild(task *memoryTask, step *memoryStep) {
+	if !step.Completed {
+		child := m.state.Tasks[step.Child]
+		if child == nil || child.Status != memoryTaskCompleted {
+			m.suspend(task)
+		}
+
+		if child.Kind == memoryTaskApi {
+			step.Output = child.ApiResult.Response
+		} else {
+			step.Output = child.ServiceResult.Output
+			step.IsError = child.ServiceResult.IsError
+			step.Error = child.ServiceResult.Error
+		}
+		step.Completed = true
+	}
+	task.Cursor++
+}
+
+// callChild journals a call to a child task and runs it, suspending the caller if the child halts.
+func (m *MemoryServiceClient) callChild(sessionId string, kind string, start func(parent *memoryTask) *memoryTask) (memoryStep, error) {
+	m.mu.Lock()
+	task := m.getTask(sessionId)
+	step, err := m.replayStep(task, kind)
+	if err != nil {
+		m.mu.Unlock()
+		return memoryStep{}, err
+	}
+
+	if step == nil {
+		if m.listener == nil {
+			m.mu.Unlock()
+			return memoryStep{}, ErrSidecarClientFailed.With("no runtime attached to memory client")
+		}
+
+		child := start(task)
+		m.recordStep(task, memoryStep{
+			Kind:  kind,
+			Child: child.SessionId,
+		})
+		m.mu.Unlock()
+
+		m.runTask(context.Background(), child.SessionId)
+		m.mu.Lock()
+		step = &task.Steps[task.Cursor]
+	}
+	defer m.mu.Unlock()
+
+	m.awaitChild(task, step)
+	return *step, nil
+}
+
+func (m *MemoryServiceClient) childMeta(parent *memoryTask) sdk.ParentMeta {
+	meta := parent.meta()
+	return sdk.ParentMeta{
+		EnvId:     meta.EnvId,
+		TaskGroup: meta.TaskGroup,
+		TaskName:  meta.TaskName,
+		TaskId:    meta.TaskId,
+		Step:      int64(parent.Cursor),
+	}
+}
+
+func (m *MemoryServiceClient) StartApp(req StartAppRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.Started = true
+	m.state.App = req
+	m.reindex()
+	return nil
+}
+
+func (m *MemoryServiceClient) CallService(sessionId string, req ExecServiceRequest) (ExecServiceResponse, error) {
+	step, err := m.callChild(sessionId, "service", func(parent *memoryTask) *memoryTask {
+		return m.newServiceTask(ServiceStartEvent{
+			Service: req.Service,
+			Method:  req.Method,
+			Meta: sdk.TaskMeta{
+				EnvId:  req.EnvId,
+				Parent: m.childMeta(parent),
+			},
+			Input: req.Input,
+		}, parent.SessionId)
+	})
+	if err != nil {
+		return ExecServiceResponse{}, err
+	}
+
+	return ExecServiceResponse{
+		Output:  step.Output,
+		IsError: step.IsError,
+		Error:   step.Error,
+	}, nil
+}
+
+func (m *MemoryServiceClient) SendService(sessionId string, req ExecServiceRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task := m.getTask(sessionId)
+	step, err := m.replayStep(task, "send")
+	if err != nil {
+		return err
+	}
+
+	if step == nil {
+		child := m.newServiceTask(ServiceStartEvent{
+			Service: req.Service,
+			Method:  req.Method,
+			Meta: sdk.TaskMeta{
+				EnvId: req.EnvId,
+			},
+			Input: req.Input,
+		}, "")
+		m.recordStep(task, memoryStep{
+			Kind:      "send",
+			Completed: true,
+			Child:     child.SessionId,
+		})
+		m.state.Pending = append(m.state.Pending, child.SessionId)
+	}
+
+	task.Cursor++
+	return nil
+}
+
+func (m *MemoryServiceClient) CallAgent(sessionId string, req ExecAgentRequest) (ExecAgentResponse, error) {
+	if m.AgentHandler == nil {
+		return ExecAgentResponse{}, ErrSidecarClientFailed.With("agent calls are not supported by memory client")
+	}
+	return m.AgentHandler(req)
+}
+
+func (m *MemoryServiceClient) CallApi(sessionId string, req ExecApiRequest) (ExecApiResponse, error) {
+	step, err := m.callChild(sessionId, "api", func(parent *memoryTask) *memoryTask {
+		request := req.Request
+		if request.Path == "" {
+			request.Path = req.Path
+		}
+
+		return m.newApiTask(ApiStartEvent{
+			Meta: sdk.TaskMeta{
+				EnvId:  req.EnvId,
+				Parent: m.childMeta(parent),
+			},
+			Request: request,
+		}, parent.SessionId)
+	})
+	if err != nil {
+		return ExecApiResponse{}, err
+	}
+
+	var response sdk.ApiResponse
+	err = ConvertType(step.Output, &response)
+	if err != nil {
+		return ExecApiResponse{}, err
+	}
+
+	return ExecApiResponse{
+		Response: response,
+	}, nil
+}
+
+func (m *MemoryServiceClient) CallApp(sessionId string, req ExecAppRequest) (ExecAppResponse, error) {
+	if m.AppHandler == nil {
+		return ExecAppResponse{}, ErrSidecarClientFailed.With("app calls are not supported by memory client")
+	}
+	return m.AppHandler(req)
+}
+
+func (m *MemoryServiceClient) SendApp(sessionId string, req ExecAppRequest) error {
+	_, err := m.CallApp(sessionId, req)
+	return err
+}
+
+func (m *MemoryServiceClient) CallServiceAsync(sessionId string, req ExecServiceRequest) (ExecAsyncResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task := m.getTask(sessionId)
+	step, err := m.replayStep(task, "async")
+	if err != nil {
+		return ExecAsyncResponse{}, err
+	}
+
+	if step == nil {
+		step = m.startAsyncChild(task, "async", req)
+	}
+
+	task.Cursor++
+	return ExecAsyncResponse{
+		CallId: fmt.Sprint(step.Output),
+	}, nil
+}
+
+// startAsyncChild queues a child service task and journals its call id. The child only starts
+// once the caller halts, like a sidecar running it in the background.
+func (m *MemoryServiceClient) startAsyncChild(task *memoryTask, kind string, req ExecServiceRequest) *memoryStep {
+	child := m.newServiceTask(ServiceStartEvent{
+		Service: req.Service,
+		Method:  req.Method,
+		Meta: sdk.TaskMeta{
+			EnvId:  req.EnvId,
+			Parent: m.childMeta(task),
+		},
+		Input: req.Input,
+	}, task.SessionId)
+
+	callId := m.nextId("call")
+	m.state.Calls[callId] = &memoryCall{
+		Child: child.SessionId,
+	}
+	m.state.Pending = append(m.state.Pending, child.SessionId)
+
+	return m.recordStep(task, memoryStep{
+		Kind:      kind,
+		Completed: true,
+		Output:    callId,
+		Child:     child.SessionId,
+	})
+}
+
+func (m *MemoryServiceClient) CallAppAsync(sessionId string, req ExecAppRequest) (ExecAsyncResponse, error) {
+	m.mu.Lock()
+	task := m.getTask(sessionId)
+	step, err := m.replayStep(task, "async")
+	if err != nil {
+		m.mu.Unlock()
+		return ExecAsyncResponse{}, err
+	} else if step != nil {
+		task.Cursor++
+		m.mu.Unlock()
+		return ExecAsyncResponse{
+			CallId: fmt.Sprint(step.Output),
+		}, nil
+	}
+	m.mu.Unlock()
+
+	output, err := m.CallApp(sessionId, req)
+	if err != nil {
+		return ExecAsyncResponse{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	callId := m.nextId("call")
+	m.state.Calls[callId] = &memoryCall{
+		Completed: true,
+		Output:    output.Output,
+		IsError:   output.IsError,
+		Error:     output.Error,
+	}
+	m.recordStep(task, memoryStep{
+		Kind:      "async",
+		Completed: true,
+		Output:    callId,
+	})
+	task.Cursor++
+
+	return ExecAsyncResponse{
+		CallId: callId,
+	}, nil
+}
+
+func (m *MemoryServiceClient) AwaitCalls(sessionId string, req AwaitCallsRequest) (AwaitCallsResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task := m.getTask(sessionId)
+	step, err := m.replayStep(task, "await")
+	if err != nil {
+		return AwaitCallsResponse{}, err
+	}
+
+	if step == nil {
+		step = m.recordStep(task, memoryStep{
+			Kind: "await",
+		})
+	}
+
+	// the results are journaled once the wait is satisfied so AwaitAny replays the same winner
+	if !step.Completed {
+		results := make([]AsyncCallResult, 0, len(req.CallIds))
+		completed := 0
+		for _, callId := range req.CallIds {
+			result, err := m.callResult(callId)
+			if err != nil {
+				return AwaitCallsResponse{}, err
+			}
+			if result.IsCompleted {
+				completed++
+			}
+			results = append(results, result)
+		}
+
+		if len(req.CallIds) > 0 && (completed == 0 || (!req.Any && completed < len(req.CallIds))) {
+			m.suspend(task)
+		}
+
+		step.Output = results
+		step.Completed = true
+	}
+
+	task.Cursor++
+	var res AwaitCallsResponse
+	err = ConvertType(step.Output, &res.Results)
+	return res, err
+}
+
+func (m *MemoryServiceClient) callResult(callId string) (AsyncCallResult, error) {
+	call := m.state.Calls[callId]
+	if call == nil {
+		return AsyncCallResult{}, ErrBadRequest.Wrap(fmt.Errorf("unknown call %s", callId))
+	}
+
+	if !call.Completed && call.Child != "" {
+		child := m.state.Tasks[call.Child]
+		if child != nil && child.Status == memoryTaskCompleted {
+			call.Completed = true
+			call.Output = child.ServiceResult.Output
+			call.IsError = child.ServiceResult.IsError
+			call.Error = child.ServiceResult.Error
+		}
+	}
+
+	return AsyncCallResult{
+		CallId:      callId,
+		IsCompleted: call.Completed,
+		Output:      call.Output,
+		IsError:     call.IsError,
+		Error:       call.Error,
+	}, nil
+}
+
+func (m *MemoryServiceClient) ExecFunc(sessionId string, req ExecFuncRequest) (ExecFuncResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task := m.getTask(sessionId)
+	step, err := m.replayStep(task, "func")
+	if err != nil {
+		return ExecFuncResponse{}, err
+	}
+
+	if step == nil {
+		return ExecFuncResponse{
+			IsCompleted: false,
+		}, nil
+	}
+
+	task.Cursor++
+	return ExecFuncResponse{
+		IsCompleted: true,
+		Output:      step.Output,
+		IsError:     step.IsError,
+		Error:       step.Error,
+	}, nil
+}
+
+func (m *MemoryServiceClient) ExecFuncResult(sessionId string, req ExecFuncResult) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task := m.getTask(sessionId)
+	m.recordStep(task, memoryStep{
+		Kind:      "func",
+		Completed: true,
+		Output:    req.Output,
+		IsError:   req.IsError,
+		Error:     req.Error,
+	})
+	task.Cursor++
+	return nil
+}
+
+func (m *MemoryServiceClient) EmitSignal(sessionId string, req SignalEmitRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// signals emitted from a task are journaled so replays do not emit them twice
+	if sessionId != "" {
+		task := m.getTask(sessionId)
+		step, err := m.replayStep(task, "emit")
+		if err != nil {
+			return err
+		}
+
+		if step != nil {
+			task.Cursor++
+			return nil
+		}
+		m.recordStep(task, memoryStep{
+			Kind:      "emit",
+			Completed: true,
+		})
+		task.Cursor++
+	}
+
+	key := req.TaskId + "/" + req.SignalName
+	m.state.Signals[key] = append(m.state.Signals[key], req)
+
+	if task := m.findTask(req.TaskId); task != nil {
+		m.wake(task.SessionId)
+	}
+	return nil
+}
+
+func (m *MemoryServiceClient) WaitForSignal(sessionId string, req SignalWaitRequest) (SignalWaitResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task := m.getTask(sessionId)
+	step, err := m.replayStep(task, "signal")
+	if err != nil {
+		return SignalWaitResponse{}, err
+	}
+
+	if step == nil {
+		// the deadline is fixed on the first wait so replays keep the original timeout
+		var deadline time.Time
+		if req.Timeout > 0 {
+			deadline = m.clock().Add(time.Duration(req.Timeout) * time.Millisecond)
+		}
+
+		step = m.recordStep(task, memoryStep{
+			Kind:     "signal",
+			Deadline: deadline,
+		})
+	}
+
+	if !step.Completed {
+		key := task.taskId() + "/" + req.SignalName
+		queue := m.state.Signals[key]
+		if len(queue) > 0 {
+			m.state.Signals[key] = queue[1:]
+			step.Output = queue[0].Output
+			step.IsError = queue[0].IsError
+			step.Error = queue[0].Error
+		} else if !step.Deadline.IsZero() && !m.clock().Before(step.Deadline) {
+			step.IsTimeout = true
+		} else if !m.interrupt(task, step) {
+			task.WaitUntil = step.Deadline
+			m.suspend(task)
+		}
+		step.Completed = true
+	}
+
+	task.Cursor++
+	return SignalWaitResponse{
+		IsAsync:   false,
+		IsTimeout: step.IsTimeout,
+		Output:    step.Output,
+		IsError:   step.IsError,
+		Error:     step.Error,
+	}, nil
+}
+
+func (m *MemoryServiceClient) Sleep(sessionId string, req SleepRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task := m.getTask(sessionId)
+	step, err := m.replayStep(task, "timer")
+	if err != nil {
+		return err
+	}
+
+	if step == nil {
+		// relative sleeps are anchored at the first execution so replays keep the same deadline
+		deadline := m.clock().Add(time.Duration(req.Duration) * time.Millisecond)
+		if req.Until > 0 {
+			deadline = time.UnixMilli(req.Until)
+		}
+
+		step = m.recordStep(task, memoryStep{
+			Kind:     "timer",
+			Deadline: deadline,
+		})
+	}
+
+	if !step.Completed {
+		if m.clock().Before(step.Deadline) && !m.interrupt(task, step) {
+			task.WaitUntil = step.Deadline
+			m.suspend(task)
+		}
+		step.Completed = true
+	}
+
+	task.Cursor++
+	if step.IsError {
+		return step.Error
+	}
+	return nil
+}
+
+func (m *MemoryServiceClient) GetVersion(sessionId string, req VersionRequest) (VersionResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task := m.getTask(sessionId)
+	if task.Versions == nil {
+		task.Versions = make(map[string]int)
+	}
+
+	// the marker is looked up at the journal position. a journal that goes on with another step
+	// means the task ran past this point before the marker was added, so it is not recorded.
+	if task.Cursor < len(task.Steps) {
+		step := task.Steps[task.Cursor]
+		if step.Kind != "version" || step.ChangeId != req.ChangeId {
+			if _, ok := task.Versions[req.ChangeId]; !ok {
+				task.Versions[req.ChangeId] = sdk.DefaultVersion
+			}
+			return VersionResponse{Version: sdk.DefaultVersion, Recorded: false}, nil
+		}
+
+		task.Cursor++
+		return VersionResponse{Version: step.Version, Recorded: true}, nil
+	}
+
+	// a change keeps the version it got earlier in the task
+	version, ok := task.Versions[req.ChangeId]
+	if !ok {
+		version = req.MaxVersion
+		task.Versions[req.ChangeId] = version
+	}
+
+	m.recordStep(task, memoryStep{
+		Kind:      "version",
+		Completed: true,
+		ChangeId:  req.ChangeId,
+		Version:   version,
+	})
+	task.Cursor++
+	return VersionResponse{Version: version, Recorded: true}, nil
+}
+
+func (m *MemoryServiceClient) EmitRealtimeEvent(sessionId string, req RealtimeEventEmitRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.Events = append(m.state.Events, req)
+	return nil
+}
+
+var _ ServiceClient = (*MemoryServiceClient)(nil)
+var _ ApiServerListener = (*MemoryServiceClient)(nil)
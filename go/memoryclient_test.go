@@ -0,0 +1,437 @@
+package runtime
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+type testInput struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type testItem struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// testService is a ClientService built from plain functions. Handlers run as service methods
+// and workflows as workflow methods, all of them take a testInput.
+type testService struct {
+	name      string
+	handlers  map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error)
+	workflows map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error)
+}
+
+func (s *testService) GetName() string {
+	return s.name
+}
+
+func (s *testService) GetDescription(method string) (string, error) {
+	return method, nil
+}
+
+func (s *testService) GetInputType(method string) (any, error) {
+	return &testInput{}, nil
+}
+
+func (s *testService) GetOutputType(method string) (any, error) {
+	return nil, nil
+}
+
+func (s *testService) IsWorkflow(method string) bool {
+	_, ok := s.workflows[method]
+	return ok
+}
+
+func (s *testService) ExecuteService(ctx sdk.ServiceContext, method string, input any) (any, error) {
+	if method == "@definition" {
+		var methods []string
+		for name := range s.handlers {
+			methods = append(methods, name)
+		}
+		for name := range s.workflows {
+			methods = append(methods, name)
+		}
+		sort.Strings(methods)
+		return methods, nil
+	}
+
+	handler, ok := s.handlers[method]
+	if !ok {
+		return nil, errors.New("unknown method " + method)
+	}
+	return handler(ctx, input.(*testInput))
+}
+
+func (s *testService) ExecuteWorkflow(ctx sdk.WorkflowContext, method string, input any) (any, error) {
+	workflow, ok := s.workflows[method]
+	if !ok {
+		return nil, errors.New("unknown method " + method)
+	}
+	return workflow(ctx, input.(*testInput))
+}
+
+// newTestClient registers services on a clean runtime and returns the memory client running them.
+// Models can be registered on GetModelRegistry afterwards, followed by startTestApp.
+func newTestClient(t *testing.T, services ...ClientService) *MemoryServiceClient {
+	t.Helper()
+
+	serviceMap = make(map[string]ClientService)
+	modelMap = make(map[string]*ModelRegistry)
+	for _, service := range services {
+		err := RegisterService(service)
+		if err != nil {
+			t.Fatalf("failed to register service %s: %s", service.GetName(), err.Error())
+		}
+	}
+
+	client := NewMemoryServiceClient()
+	client.Attach(NewClientRuntime(client))
+	startTestApp(t, client)
+	return client
+}
+
+// startTestApp sends the description of the registered services and models to the client
+func startTestApp(t *testing.T, client *MemoryServiceClient) {
+	t.Helper()
+
+	services, err := ExtractServiceDescription(serviceMap, modelMap)
+	if err != nil {
+		t.Fatalf("failed to extract service description: %s", err.Error())
+	}
+
+	err = client.StartApp(StartAppRequest{
+		AppName:  "test",
+		Services: services,
+	})
+	if err != nil {
+		t.Fatalf("failed to start app: %s", err.Error())
+	}
+}
+
+func runService(client *MemoryServiceClient, service string, method string, input testInput) ServiceCompleteEvent {
+	return client.RunService(context.Background(), ServiceStartEvent{
+		Service: service,
+		Method:  method,
+		Input:   input,
+	})
+}
+
+// mustOutput fails the test when the task failed and decodes its output into ret
+func mustOutput(t *testing.T, evt ServiceCompleteEvent, ret any) {
+	t.Helper()
+
+	if evt.IsError {
+		t.Fatalf("task failed: %s", evt.Error.Error())
+	}
+	err := ConvertType(evt.Output, ret)
+	if err != nil {
+		t.Fatalf("failed to decode output %v: %s", evt.Output, err.Error())
+	}
+}
+
+func TestMemoryClient_DataRoundTrip(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Put": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				_, err := ctx.Db().Get().ServiceCollection("items").InsertOne(input.Name, &testItem{Name: input.Name, Count: input.Count})
+				return nil, err
+			},
+			"Get": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				doc, err := ctx.Db().Get().ServiceCollection("items").GetOne(input.Name)
+				if err != nil {
+					return nil, err
+				}
+
+				var item testItem
+				err = doc.Unmarshal(&item)
+				return item, err
+			},
+			"Large": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				docs, err := ctx.Db().Get().ServiceCollection("items").Query().Filter("count > ?", input.Count).GetAll(ctx)
+				return len(docs), err
+			},
+		},
+	})
+
+	for i, name := range []string{"a", "b", "c"} {
+		evt := runService(client, "store", "Put", testInput{Name: name, Count: i})
+		if evt.IsError {
+			t.Fatalf("put %s failed: %s", name, evt.Error.Error())
+		}
+	}
+
+	var item testItem
+	mustOutput(t, runService(client, "store", "Get", testInput{Name: "b"}), &item)
+	if item != (testItem{Name: "b", Count: 1}) {
+		t.Fatalf("unexpected item %+v", item)
+	}
+
+	var count int
+	mustOutput(t, runService(client, "store", "Large", testInput{Count: 0}), &count)
+	if count != 2 {
+		t.Fatalf("expected 2 matching documents, got %d", count)
+	}
+
+	evt := runService(client, "store", "Get", testInput{Name: "missing"})
+	if !evt.IsError {
+		t.Fatalf("expected missing document to fail, got %v", evt.Output)
+	}
+}
+
+func TestMemoryClient_Files(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "files",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Append": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				folder, err := ctx.FileStore().Get().AppFolder().Folder("reports")
+				if err != nil {
+					return nil, err
+				}
+
+				file, err := folder.File(input.Name)
+				if err != nil {
+					return nil, err
+				}
+
+				data, err := file.Read()
+				if err != nil {
+					return nil, err
+				}
+				return nil, file.Save(append(data, " world"...))
+			},
+		},
+	})
+
+	err := client.CreateFolder("", CreateFolderRequest{
+		Scope:      sdk.DataScopeApp,
+		FolderPath: "/reports",
+	})
+	if err != nil {
+		t.Fatalf("failed to create folder: %s", err.Error())
+	}
+
+	err = client.PutFile("", PutFileRequest{
+		Scope:   sdk.DataScopeApp,
+		Path:    "/reports/a.txt",
+		Content: base64.StdEncoding.EncodeToString([]byte("hello")),
+	})
+	if err != nil {
+		t.Fatalf("failed to put file: %s", err.Error())
+	}
+
+	evt := runService(client, "files", "Append", testInput{Name: "a.txt"})
+	if evt.IsError {
+		t.Fatalf("append failed: %s", evt.Error.Error())
+	}
+
+	res, err := client.ReadFileContent("", ReadFileContentRequest{
+		Scope: sdk.DataScopeApp,
+		Path:  "/reports/a.txt",
+	})
+	if err != nil {
+		t.Fatalf("failed to read file: %s", err.Error())
+	}
+	if decoded, _ := base64.StdEncoding.DecodeString(res.Content); string(decoded) != "hello world" {
+		t.Fatalf("unexpected stored content %q", decoded)
+	}
+}
+
+func TestMemoryClient_MemoAndServiceCall(t *testing.T) {
+	memoCalls := 0
+	client := newTestClient(t, &testService{
+		name: "flow",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Double": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				return input.Count * 2, nil
+			},
+		},
+		workflows: map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error){
+			"Run": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				var base int
+				err := ctx.Memo(func() (any, error) {
+					memoCalls++
+					return input.Count + 1, nil
+				}).Get(&base)
+				if err != nil {
+					return nil, err
+				}
+
+				res, err := ctx.Service("flow").Get().RequestReply(sdk.TaskOptions{}, "Double", testInput{Count: base})
+				if err != nil {
+					return nil, err
+				}
+
+				var doubled int
+				err = res.Get(&doubled)
+				return doubled, err
+			},
+		},
+	})
+
+	var out int
+	mustOutput(t, runService(client, "flow", "Run", testInput{Count: 4}), &out)
+	if out != 10 {
+		t.Fatalf("expected 10, got %d", out)
+	}
+	if memoCalls != 1 {
+		t.Fatalf("expected the memo to run once across replays, ran %d times", memoCalls)
+	}
+}
+
+func TestMemoryClient_Locks(t *testing.T) {
+	client := NewMemoryServiceClient()
+	ttl := time.Now().Add(time.Minute).Unix()
+
+	err := client.AcquireLock("s1", AcquireLockRequest{Key: "k", TTL: ttl})
+	if err != nil {
+		t.Fatalf("failed to acquire lock: %s", err.Error())
+	}
+
+	err = client.AcquireLock("s2", AcquireLockRequest{Key: "k", TTL: ttl})
+	if !sdk.IsError(err, sdk.ErrConflict) {
+		t.Fatalf("expected conflict for a held lock, got %v", err)
+	}
+
+	err = client.ReleaseLock("s1", ReleaseLockRequest{Key: "k"})
+	if err != nil {
+		t.Fatalf("failed to release lock: %s", err.Error())
+	}
+
+	err = client.AcquireLock("s2", AcquireLockRequest{Key: "k", TTL: ttl})
+	if err != nil {
+		t.Fatalf("failed to acquire released lock: %s", err.Error())
+	}
+}
+
+func TestMemoryClient_SaveLoad(t *testing.T) {
+	client := NewMemoryServiceClient()
+	err := client.StartApp(StartAppRequest{AppName: "test"})
+	if err != nil {
+		t.Fatalf("failed to start app: %s", err.Error())
+	}
+
+	_, err = client.InsertData("", InsertDataRequest{
+		Scope:          sdk.DataScopeApp,
+		Path:           "items/a",
+		CollectionPath: "items",
+		Item:           map[string]interface{}{"name": "a"},
+	})
+	if err != nil {
+		t.Fatalf("failed to insert: %s", err.Error())
+	}
+
+	path := t.TempDir() + "/state.json"
+	err = client.Save(path)
+	if err != nil {
+		t.Fatalf("failed to save: %s", err.Error())
+	}
+
+	loaded := NewMemoryServiceClient()
+	err = loaded.Load(path)
+	if err != nil {
+		t.Fatalf("failed to load: %s", err.Error())
+	}
+
+	data, err := loaded.GetData("", GetDataRequest{Scope: sdk.DataScopeApp, Path: "items/a"})
+	if err != nil || !data.Exist || data.Data["name"] != "a" {
+		t.Fatalf("document not restored: %+v %v", data, err)
+	}
+}
+
+func TestMemoryClient_WritesNeedAStartedApp(t *testing.T) {
+	client := NewMemoryServiceClient()
+	req := InsertDataRequest{
+		Scope:          sdk.DataScopeApp,
+		Path:           "items/a",
+		CollectionPath: "items",
+		Item:           map[string]interface{}{"name": "a"},
+	}
+
+	// the unique indexes of items are not known before the app is started
+	_, err := client.InsertData("", req)
+	if err == nil || !strings.Contains(err.Error(), "app not started") {
+		t.Fatalf("expected a write before the app started to fail, got %v", err)
+	}
+
+	err = client.StartApp(StartAppRequest{AppName: "test"})
+	if err != nil {
+		t.Fatalf("failed to start app: %s", err.Error())
+	}
+	_, err = client.InsertData("", req)
+	if err != nil {
+		t.Fatalf("failed to insert: %s", err.Error())
+	}
+}
+
+func TestMemoryClient_ServiceScopeIsPerService(t *testing.T) {
+	counterService := func(name string) *testService {
+		return &testService{
+			name: name,
+			handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+				"Put": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+					_, err := ctx.Db().Get().ServiceCollection("counters").InsertOne(input.Name, &testItem{Name: name})
+					if err != nil {
+						return nil, err
+					}
+
+					file, err := ctx.FileStore().Get().ServiceFolder().CreateNewFolder(name)
+					return file.Path(), err
+				},
+				"List": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+					docs, err := ctx.Db().Get().ServiceCollection("counters").Query().GetAll(ctx)
+					if err != nil {
+						return nil, err
+					}
+
+					var owners []string
+					for _, doc := range docs {
+						var item testItem
+						if err := doc.Unmarshal(&item); err != nil {
+							return nil, err
+						}
+						owners = append(owners, item.Name)
+					}
+					return owners, nil
+				},
+				"Folder": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+					_, err := ctx.FileStore().Get().ServiceFolder().Folder(input.Name)
+					return err == nil, nil
+				},
+			},
+		}
+	}
+	client := newTestClient(t, counterService("svcA"), counterService("svcB"))
+
+	for _, service := range []string{"svcA", "svcB"} {
+		evt := runService(client, service, "Put", testInput{Name: "c1"})
+		if evt.IsError {
+			t.Fatalf("%s put failed: %s", service, evt.Error.Error())
+		}
+	}
+
+	var owners []string
+	mustOutput(t, runService(client, "svcB", "List", testInput{}), &owners)
+	if len(owners) != 1 || owners[0] != "svcB" {
+		t.Fatalf("svcB sees documents of other services: %v", owners)
+	}
+
+	var found bool
+	mustOutput(t, runService(client, "svcB", "Folder", testInput{Name: "svcA"}), &found)
+	if found {
+		t.Fatal("svcB sees a folder created by svcA")
+	}
+	mustOutput(t, runService(client, "svcB", "Folder", testInput{Name: "svcB"}), &found)
+	if !found {
+		t.Fatal("svcB does not see its own folder")
+	}
+}
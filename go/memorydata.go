@@ -0,0 +1,933 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type memoryDocument struct {
+	Service        string                 `json:"service"`
+	Scope          sdk.DataScope          `json:"scope"`
+	TenantId       string                 `json:"tenantId"`
+	Path           string                 `json:"path"`
+	ParentPath     string                 `json:"parentPath"`
+	CollectionPath string                 `json:"collectionPath"`
+	Type           string                 `json:"type"`
+	Version        int64                  `json:"version"`
+	SchemaVersion  int                    `json:"schemaVersion"`
+	Data           map[string]interface{} `json:"data"`
+	CreatedAt      time.Time              `json:"createdAt"`
+	UpdatedAt      time.Time              `json:"updatedAt"`
+	ExpiresAt      time.Time              `json:"expiresAt"`
+}
+
+func (d *memoryDocument) response(data map[string]interface{}) GetDataResponse {
+	return GetDataResponse{
+		Path:          d.Path,
+		Exist:         true,
+		Version:       d.Version,
+		SchemaVersion: d.SchemaVersion,
+		CreatedAt:     d.CreatedAt,
+		UpdatedAt:     d.UpdatedAt,
+		ExpiresAt:     d.ExpiresAt,
+		Data:          data,
+	}
+}
+
+func (d *memoryDocument) writeResponse() WriteDataResponse {
+	return WriteDataResponse{
+		Version:   d.Version,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+		ExpiresAt: d.ExpiresAt,
+	}
+}
+
+type memoryLock struct {
+	Owner     string `json:"owner"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+func memoryKey(scope sdk.DataScope, tenantId string, path string) string {
+	return string(scope) + "|" + tenantId + "|" + path
+}
+
+// storeKey is the key documents and files are stored under, service scoped ones are kept per service
+func storeKey(service string, scope sdk.DataScope, tenantId string, path string) string {
+	if service == "" {
+		return memoryKey(scope, tenantId, path)
+	}
+	return service + "|" + memoryKey(scope, tenantId, path)
+}
+
+// owner returns the service whose storage a request in the session uses, empty for app scope
+// and for requests made outside of a task.
+func (m *MemoryServiceClient) owner(sessionId string, scope sdk.DataScope) string {
+	if scope != sdk.DataScopeService {
+		return ""
+	}
+	if task := m.state.Tasks[sessionId]; task != nil && task.Kind == memoryTaskService {
+		return task.Service.Service
+	}
+	return ""
+}
+
+// getDocument returns a live document, dropping it when its ttl has passed.
+func (m *MemoryServiceClient) getDocument(service string, scope sdk.DataScope, tenantId string, path string) *memoryDocument {
+	return m.documentAt(storeKey(service, scope, tenantId, path))
+}
+
+func (m *MemoryServiceClient) documentAt(key string) *memoryDocument {
+	doc := m.state.Documents[key]
+	if doc != nil && !doc.ExpiresAt.IsZero() && !m.clock().Before(doc.ExpiresAt) {
+		m.removeDocument(key)
+		return nil
+	}
+	return doc
+}
+
+// putDocument stores doc under key, keeping the unique index in step
+func (m *MemoryServiceClient) putDocument(key string, doc *memoryDocument) {
+	if old := m.state.Documents[key]; old != nil {
+		m.unindexDocument(key, old)
+	}
+	m.state.Documents[key] = doc
+	m.indexDocument(key, doc)
+}
+
+func (m *MemoryServiceClient) removeDocument(key string) {
+	if old := m.state.Documents[key]; old != nil {
+		m.unindexDocument(key, old)
+	}
+	delete(m.state.Documents, key)
+}
+
+func (m *MemoryServiceClient) checkVersion(doc *memoryDocument, cfg sdk.WriteConfig) error {
+	if cfg.Unsafe || cfg.VersionEquals == 0 || doc.Version == cfg.VersionEquals {
+		return nil
+	}
+	return sdk.ErrConflict
+}
+
+// checkStarted rejects writes made before StartApp, as the unique indexes of the collections are
+// only known once the app has described its models.
+func (m *MemoryServiceClient) checkStarted(collectionPath string) error {
+	if !m.state.Started {
+		return ErrBadRequest.Wrap(fmt.Errorf("app not started, the indexes of collection %s are not known", collectionPath))
+	}
+	return nil
+}
+
+// uniqueKeys returns the unique index entries doc holds in its collection. Documents that miss one
+// of the indexed fields are not constrained.
+func (m *MemoryServiceClient) uniqueKeys(doc *memoryDocument) []string {
+	name := fileName(doc.CollectionPath)
+	collectionKey := storeKey(doc.Service, doc.Scope, doc.TenantId, doc.CollectionPath)
+
+	var keys []string
+	for _, service := range m.state.App.Services {
+		if doc.Service != "" && service.Name != doc.Service {
+			continue
+		}
+
+		for _, collection := range service.Collections {
+			if collection.Name != name {
+				continue
+			}
+
+			for _, index := range collection.Indexes {
+				key, ok := indexKey(doc.Data, index.Fields)
+				if index.Unique && ok {
+					keys = append(keys, collectionKey+"|"+index.Name+"|"+key)
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// checkUnique rejects a document whose values for a unique index are taken by another live
+// document of its collection. Uniqueness is only enforced by this client, the sidecar has to
+// enforce it on its own store as the runtime does not check it.
+func (m *MemoryServiceClient) checkUnique(doc *memoryDocument) error {
+	key := storeKey(doc.Service, doc.Scope, doc.TenantId, doc.Path)
+	for _, unique := range m.uniqueKeys(doc) {
+		holder, ok := m.unique[unique]
+		if ok && holder != key && m.documentAt(holder) != nil {
+			return sdk.ErrAlreadyExist
+		}
+	}
+	return nil
+}
+
+func (m *MemoryServiceClient) indexDocument(key string, doc *memoryDocument) {
+	for _, unique := range m.uniqueKeys(doc) {
+		m.unique[unique] = key
+	}
+}
+
+func (m *MemoryServiceClient) unindexDocument(key string, doc *memoryDocument) {
+	for _, unique := range m.uniqueKeys(doc) {
+		if m.unique[unique] == key {
+			delete(m.unique, unique)
+		}
+	}
+}
+
+// reindex rebuilds the unique index from the documents, once the app or the state changes
+func (m *MemoryServiceClient) reindex() {
+	m.unique = make(map[string]string)
+	for key, doc := range m.state.Documents {
+		m.indexDocument(key, doc)
+	}
+}
+
+func indexKey(data map[string]interface{}, fields []string) (string, bool) {
+	var key []any
+	for _, field := range fields {
+		value := lookupField(data, field)
+		if value == nil {
+			return "", false
+		}
+		key = append(key, value)
+	}
+	return groupId(key), true
+}
+
+func (m *MemoryServiceClient) expiresAt(expireIn time.Duration) time.Time {
+	if expireIn <= 0 {
+		return time.Time{}
+	}
+	return m.clock().Add(expireIn)
+}
+
+// copyData deep copies a document through json so stored documents never alias caller maps.
+func copyData(data map[string]interface{}) (map[string]interface{}, error) {
+	var copied map[string]interface{}
+	err := ConvertType(data, &copied)
+	return copied, err
+}
+
+// matchDocuments returns the live documents of a collection that match the filter.
+func (m *MemoryServiceClient) matchDocuments(service string, scope sdk.DataScope, tenantId string, collectionPath string, filter memoryFilter) ([]*memoryDocument, error) {
+	var docs []*memoryDocument
+	for _, doc := range m.state.Documents {
+		if doc.Service != service || doc.Scope != scope || doc.TenantId != tenantId || doc.CollectionPath != collectionPath {
+			continue
+		}
+		if m.getDocument(doc.Service, doc.Scope, doc.TenantId, doc.Path) == nil {
+			continue
+		}
+
+		match, err := filter.match(doc.Data)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+func (m *MemoryServiceClient) AggregateData(sessionId string, req AggregateDataRequest) (AggregateDataResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	filter, err := parseMemoryFilter(req.Filter, req.Args)
+	if err != nil {
+		return AggregateDataResponse{}, err
+	}
+
+	docs, err := m.matchDocuments(m.owner(sessionId, req.Scope), req.Scope, req.TenantId, req.CollectionPath, filter)
+	if err != nil {
+		return AggregateDataResponse{}, err
+	}
+
+	var keys [][]any
+	groups := make(map[string][]*memoryDocument)
+	for _, doc := range docs {
+		key := make([]any, 0, len(req.GroupBy))
+		for _, field := range req.GroupBy {
+			key = append(key, lookupField(doc.Data, field))
+		}
+
+		id := groupId(key)
+		if _, ok := groups[id]; !ok {
+			keys = append(keys, key)
+		}
+		groups[id] = append(groups[id], doc)
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		for k := range keys[i] {
+			if c := orderValues(keys[i][k], keys[j][k]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	res := AggregateDataResponse{
+		Groups: make([]sdk.AggregateGroup, 0, len(keys)),
+	}
+	for _, key := range keys {
+		group := sdk.AggregateGroup{
+			Key:    make(map[string]interface{}),
+			Values: make([]interface{}, 0, len(req.Aggregates)),
+		}
+		for i, field := range req.GroupBy {
+			group.Key[field] = key[i]
+		}
+
+		for _, aggregate := range req.Aggregates {
+			value, err := aggregateDocuments(groups[groupId(key)], aggregate)
+			if err != nil {
+				return AggregateDataResponse{}, err
+			}
+			group.Values = append(group.Values, value)
+		}
+		res.Groups = append(res.Groups, group)
+	}
+	return res, nil
+}
+
+func groupId(key []any) string {
+	// keys hold json values, so they always marshal
+	id, _ := json.Marshal(key)
+	return string(id)
+}
+
+// aggregateDocuments computes one aggregate, sum skips non numeric values and min/max skip missing ones.
+func aggregateDocuments(docs []*memoryDocument, aggregate sdk.Aggregate) (any, error) {
+	switch aggregate.Op {
+	case sdk.AggregateCount:
+		return float64(len(docs)), nil
+	case sdk.AggregateSum:
+		sum := 0.0
+		for _, doc := range docs {
+			if value, ok := lookupField(doc.Data, aggregate.Field).(float64); ok {
+				sum += value
+			}
+		}
+		return sum, nil
+	case sdk.AggregateMin, sdk.AggregateMax:
+		var ret any
+		for _, doc := range docs {
+			value := lookupField(doc.Data, aggregate.Field)
+			if value == nil {
+				continue
+			}
+
+			c := orderValues(value, ret)
+			if ret == nil || (aggregate.Op == sdk.AggregateMin && c < 0) || (aggregate.Op == sdk.AggregateMax && c > 0) {
+				ret = value
+			}
+		}
+		return ret, nil
+	default:
+		return nil, ErrBadRequest.Wrap(fmt.Errorf("unsupported aggregate %s", aggregate.Op))
+	}
+}
+
+// sortDocuments orders documents by the given keys, falling back to the document path.
+func sortDocuments(docs []*memoryDocument, orderBy []sdk.OrderBy) error {
+	return sortByFields(docs, orderBy, func(doc *memoryDocument) (string, map[string]interface{}) {
+		return doc.Path, doc.Data
+	})
+}
+
+// sortByFields orders items by the given keys of their data, falling back to their path.
+func sortByFields[T any](items []T, orderBy []sdk.OrderBy, fields func(item T) (string, map[string]interface{})) error {
+	for _, key := range orderBy {
+		if key.Order != "" && key.Order != sdk.SortAsc && key.Order != sdk.SortDesc {
+			return ErrBadRequest.Wrap(fmt.Errorf("invalid sort order %s for field %s", key.Order, key.Field))
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		iPath, iData := fields(items[i])
+		jPath, jData := fields(items[j])
+		for _, key := range orderBy {
+			c := orderValues(lookupField(iData, key.Field), lookupField(jData, key.Field))
+			if c == 0 {
+				continue
+			}
+			if key.Order == sdk.SortDesc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return iPath < jPath
+	})
+	return nil
+}
+
+// orderValues is a total order over json values, values of different types sort by type.
+func orderValues(a any, b any) int {
+	c := compareValues(a, b)
+	if c != incomparable {
+		return c
+	}
+
+	// compareValues only tests booleans for equality
+	if av, ok := a.(bool); ok {
+		if bv, ok := b.(bool); ok && !av && bv {
+			return -1
+		} else if ok {
+			return 1
+		}
+	}
+	return valueRank(a) - valueRank(b)
+}
+
+func valueRank(value any) int {
+	switch value.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// projectData keeps only the selected fields of a document, dotted paths keep nested fields.
+func projectData(data map[string]interface{}, fields []string) map[string]interface{} {
+	projected := make(map[string]interface{})
+	for _, field := range fields {
+		value := lookupField(data, field)
+		if value == nil {
+			continue
+		}
+
+		setField(projected, field, value)
+	}
+	return projected
+}
+
+func (m *MemoryServiceClient) GetData(sessionId string, req GetDataRequest) (GetDataResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	doc := m.getDocument(m.owner(sessionId, req.Scope), req.Scope, req.TenantId, req.Path)
+	if doc == nil {
+		return GetDataResponse{
+			Path:  req.Path,
+			Exist: false,
+		}, nil
+	}
+
+	data, err := copyData(doc.Data)
+	if err != nil {
+		return GetDataResponse{}, err
+	}
+
+	return doc.response(data), nil
+}
+
+func (m *MemoryServiceClient) GetMany(sessionId string, req GetManyRequest) (GetManyResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := GetManyResponse{
+		Items: make([]GetDataResponse, 0, len(req.Items)),
+	}
+	for _, item := range req.Items {
+		doc := m.getDocument(m.owner(sessionId, item.Scope), item.Scope, item.TenantId, item.Path)
+		if doc == nil {
+			res.Items = append(res.Items, GetDataResponse{
+				Path:  item.Path,
+				Exist: false,
+			})
+			continue
+		}
+
+		data, err := copyData(doc.Data)
+		if err != nil {
+			return GetManyResponse{}, err
+		}
+		res.Items = append(res.Items, doc.response(data))
+	}
+	return res, nil
+}
+
+func (m *MemoryServiceClient) QueryData(sessionId string, req QueryDataRequest) (QueryDataResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	filter, err := parseMemoryFilter(req.Filter, req.Args)
+	if err != nil {
+		return QueryDataResponse{}, err
+	}
+
+	docs, err := m.matchDocuments(m.owner(sessionId, req.Scope), req.Scope, req.TenantId, req.CollectionPath, filter)
+	if err != nil {
+		return QueryDataResponse{}, err
+	}
+
+	err = sortDocuments(docs, req.OrderBy)
+	if err != nil {
+		return QueryDataResponse{}, err
+	}
+
+	offset := 0
+	if req.OffsetToken != "" {
+		offset, err = strconv.Atoi(req.OffsetToken)
+		if err != nil || offset < 0 {
+			return QueryDataResponse{}, ErrBadRequest.Wrap(fmt.Errorf("invalid offset token %s", req.OffsetToken))
+		}
+	}
+
+	limit := req.Limit
+	if limit <= 0 || limit > memoryPageSize {
+		limit = memoryPageSize
+	}
+
+	res := QueryDataResponse{
+		Data: make([]GetDataResponse, 0),
+	}
+	for i := offset; i < len(docs) && i < offset+limit; i++ {
+		data, err := copyData(docs[i].Data)
+		if err != nil {
+			return QueryDataResponse{}, err
+		}
+		if len(req.Select) > 0 {
+			data = projectData(data, req.Select)
+		}
+
+		res.Data = append(res.Data, docs[i].response(data))
+	}
+
+	if offset+limit < len(docs) {
+		res.NextToken = strconv.Itoa(offset + limit)
+	}
+	return res, nil
+}
+
+func (m *MemoryServiceClient) InsertData(sessionId string, req InsertDataRequest) (WriteDataResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publishChanges(sessionId)
+
+	service := m.owner(sessionId, req.Scope)
+	err := m.insertData(service, req)
+	if err != nil {
+		return WriteDataResponse{}, err
+	}
+	return m.getDocument(service, req.Scope, req.TenantId, req.Path).writeResponse(), nil
+}
+
+func (m *MemoryServiceClient) insertData(service string, req InsertDataRequest) error {
+	err := m.checkStarted(req.CollectionPath)
+	if err != nil {
+		return err
+	}
+
+	doc := m.getDocument(service, req.Scope, req.TenantId, req.Path)
+	if doc != nil && !req.Cfg.Upsert {
+		return sdk.ErrAlreadyExist
+	}
+
+	data, err := copyData(req.Item)
+	if err != nil {
+		return err
+	}
+
+	now := m.clock()
+	version := int64(1)
+	createdAt := now
+	changeType := sdk.ChangeInsert
+	var oldData map[string]interface{}
+	if doc != nil {
+		version = doc.Version + 1
+		createdAt = doc.CreatedAt
+		changeType = sdk.ChangeUpdate
+		oldData = doc.Data
+	}
+
+	doc = &memoryDocument{
+		Service:        service,
+		Scope:          req.Scope,
+		TenantId:       req.TenantId,
+		Path:           req.Path,
+		ParentPath:     req.ParentPath,
+		CollectionPath: req.CollectionPath,
+		Type:           req.Type,
+		Version:        version,
+		SchemaVersion:  req.SchemaVersion,
+		Data:           data,
+		CreatedAt:      createdAt,
+		UpdatedAt:      now,
+		ExpiresAt:      m.expiresAt(req.Cfg.ExpireIn),
+	}
+	err = m.checkUnique(doc)
+	if err != nil {
+		return err
+	}
+
+	m.putDocument(storeKey(service, req.Scope, req.TenantId, req.Path), doc)
+	m.recordChange(changeType, doc, oldData, data)
+	return nil
+}
+
+func (m *MemoryServiceClient) UpdateData(sessionId string, req UpdateDataRequest) (WriteDataResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publishChanges(sessionId)
+
+	service := m.owner(sessionId, req.Scope)
+	err := m.updateData(service, req)
+	if err != nil {
+		return WriteDataResponse{}, err
+	}
+	return m.getDocument(service, req.Scope, req.TenantId, req.Path).writeResponse(), nil
+}
+
+func (m *MemoryServiceClient) updateData(service string, req UpdateDataRequest) error {
+	err := m.checkStarted(fileDir(req.Path))
+	if err != nil {
+		return err
+	}
+
+	doc := m.getDocument(service, req.Scope, req.TenantId, req.Path)
+	if doc == nil {
+		return sdk.ErrNotFound
+	}
+
+	err = m.checkVersion(doc, req.Cfg)
+	if err != nil {
+		return err
+	}
+
+	data, err := copyData(req.Item)
+	if err != nil {
+		return err
+	}
+
+	updated := *doc
+	updated.Data = data
+	err = m.checkUnique(&updated)
+	if err != nil {
+		return err
+	}
+
+	updated.Version++
+	updated.UpdatedAt = m.clock()
+	if req.SchemaVersion != 0 {
+		updated.SchemaVersion = req.SchemaVersion
+	}
+	if req.Cfg.ExpireIn > 0 {
+		updated.ExpiresAt = m.expiresAt(req.Cfg.ExpireIn)
+	}
+	m.putDocument(storeKey(service, req.Scope, req.TenantId, req.Path), &updated)
+	m.recordChange(sdk.ChangeUpdate, &updated, doc.Data, data)
+	return nil
+}
+
+func (m *MemoryServiceClient) DeleteData(sessionId string, req DeleteDataRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publishChanges(sessionId)
+	return m.deleteData(m.owner(sessionId, req.Scope), req)
+}
+
+func (m *MemoryServiceClient) deleteData(service string, req DeleteDataRequest) error {
+	doc := m.getDocument(service, req.Scope, req.TenantId, req.Path)
+	if doc == nil {
+		return sdk.ErrNotFound
+	}
+
+	err := m.checkVersion(doc, req.Cfg)
+	if err != nil {
+		return err
+	}
+
+	m.removeDocument(storeKey(service, req.Scope, req.TenantId, req.Path))
+	m.recordChange(sdk.ChangeDelete, doc, doc.Data, nil)
+	return nil
+}
+
+func (m *MemoryServiceClient) UpdateTTL(sessionId string, req UpdateTTLRequest) (WriteDataResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	service := m.owner(sessionId, req.Scope)
+	err := m.updateTTL(service, req)
+	if err != nil {
+		return WriteDataResponse{}, err
+	}
+	return m.getDocument(service, req.Scope, req.TenantId, req.Path).writeResponse(), nil
+}
+
+func (m *MemoryServiceClient) updateTTL(service string, req UpdateTTLRequest) error {
+	doc := m.getDocument(service, req.Scope, req.TenantId, req.Path)
+	if doc == nil {
+		return sdk.ErrNotFound
+	}
+
+	err := m.checkVersion(doc, req.Cfg)
+	if err != nil {
+		return err
+	}
+
+	doc.ExpiresAt = m.expiresAt(req.Cfg.ExpireIn)
+	doc.Version++
+	doc.UpdatedAt = m.clock()
+	return nil
+}
+
+func (m *MemoryServiceClient) PatchData(sessionId string, req PatchDataRequest) (GetDataResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publishChanges(sessionId)
+
+	service := m.owner(sessionId, req.Scope)
+	doc := m.getDocument(service, req.Scope, req.TenantId, req.Path)
+	if doc == nil {
+		return GetDataResponse{}, sdk.ErrNotFound
+	} else if req.SchemaVersion > max(doc.SchemaVersion, 1) {
+		return GetDataResponse{}, sdk.ErrStaleSchema.With(req.Path, doc.SchemaVersion, req.SchemaVersion)
+	}
+
+	data, err := copyData(doc.Data)
+	if err != nil {
+		return GetDataResponse{}, err
+	}
+
+	err = applyPatch(data, req.Ops)
+	if err != nil {
+		return GetDataResponse{}, err
+	}
+
+	err = m.updateData(service, UpdateDataRequest{
+		Scope:    req.Scope,
+		TenantId: req.TenantId,
+		Path:     req.Path,
+		Item:     data,
+		Cfg:      req.Cfg,
+	})
+	if err != nil {
+		return GetDataResponse{}, err
+	}
+
+	return m.getDocument(service, req.Scope, req.TenantId, req.Path).response(data), nil
+}
+
+func (m *MemoryServiceClient) InsertMany(sessionId string, req InsertManyRequest) (BatchWriteResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publishChanges(sessionId)
+
+	res := BatchWriteResponse{
+		Results: make([]sdk.BatchResult, 0, len(req.Items)),
+	}
+	for _, item := range req.Items {
+		res.Results = append(res.Results, batchResult(item.Path, m.insertData(m.owner(sessionId, item.Scope), item)))
+	}
+	return res, nil
+}
+
+func (m *MemoryServiceClient) UpdateMany(sessionId string, req UpdateManyRequest) (BatchWriteResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publishChanges(sessionId)
+
+	docs, err := m.batchDocuments(m.owner(sessionId, req.Scope), req.Scope, req.TenantId, req.CollectionPath, req.Filter, req.Args)
+	if err != nil {
+		return BatchWriteResponse{}, err
+	}
+
+	res := BatchWriteResponse{
+		Results: make([]sdk.BatchResult, 0, len(docs)),
+	}
+	for _, doc := range docs {
+		data, err := copyData(doc.Data)
+		if err == nil {
+			for field, value := range req.Patch {
+				setField(data, field, value)
+			}
+
+			err = m.updateData(doc.Service, UpdateDataRequest{
+				Scope:    doc.Scope,
+				TenantId: doc.TenantId,
+				Path:     doc.Path,
+				Item:     data,
+				Cfg:      req.Cfg,
+			})
+		}
+		res.Results = append(res.Results, batchResult(doc.Path, err))
+	}
+	return res, nil
+}
+
+func (m *MemoryServiceClient) DeleteMany(sessionId string, req DeleteManyRequest) (BatchWriteResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publishChanges(sessionId)
+
+	docs, err := m.batchDocuments(m.owner(sessionId, req.Scope), req.Scope, req.TenantId, req.CollectionPath, req.Filter, req.Args)
+	if err != nil {
+		return BatchWriteResponse{}, err
+	}
+
+	res := BatchWriteResponse{
+		Results: make([]sdk.BatchResult, 0, len(docs)),
+	}
+	for _, doc := range docs {
+		err = m.deleteData(doc.Service, DeleteDataRequest{
+			Scope:    doc.Scope,
+			TenantId: doc.TenantId,
+			Path:     doc.Path,
+			Cfg:      req.Cfg,
+		})
+		res.Results = append(res.Results, batchResult(doc.Path, err))
+	}
+	return res, nil
+}
+
+func (m *MemoryServiceClient) batchDocuments(service string, scope sdk.DataScope, tenantId string, collectionPath string, expr string, args []interface{}) ([]*memoryDocument, error) {
+	filter, err := parseMemoryFilter(expr, args)
+	if err != nil {
+		return nil, ErrBadRequest.Wrap(err)
+	}
+
+	docs, err := m.matchDocuments(service, scope, tenantId, collectionPath, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].Path < docs[j].Path
+	})
+	return docs, nil
+}
+
+func batchResult(path string, err error) sdk.BatchResult {
+	if err == nil {
+		return sdk.BatchResult{
+			Path: path,
+		}
+	}
+
+	return sdk.BatchResult{
+		Path:    path,
+		IsError: true,
+		Error:   ErrorToSdkError(err),
+	}
+}
+
+func (m *MemoryServiceClient) CommitTransaction(sessionId string, req CommitTransactionRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publishChanges(sessionId)
+
+	for _, read := range req.Reads {
+		var version int64
+		if doc := m.getDocument(m.owner(sessionId, read.Scope), read.Scope, read.TenantId, read.Path); doc != nil {
+			version = doc.Version
+		}
+		if version != read.Version {
+			return sdk.ErrConflict
+		}
+	}
+
+	// documents as they were before the transaction, nil for ones that did not exist
+	touched := make(map[string]*memoryDocument)
+	var err error
+	for _, write := range req.Writes {
+		scope, tenantId, path := write.target()
+		service := m.owner(sessionId, scope)
+		key := storeKey(service, scope, tenantId, path)
+		if _, ok := touched[key]; !ok {
+			touched[key] = nil
+			if doc := m.getDocument(service, scope, tenantId, path); doc != nil {
+				prior := *doc
+				touched[key] = &prior
+			}
+		}
+
+		if err = m.applyWrite(service, write); err != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		m.changes = nil
+		for key, prior := range touched {
+			if prior == nil {
+				m.removeDocument(key)
+			} else {
+				m.putDocument(key, prior)
+			}
+		}
+	}
+	return err
+}
+
+func (w TransactionWrite) target() (sdk.DataScope, string, string) {
+	switch {
+	case w.Insert != nil:
+		return w.Insert.Scope, w.Insert.TenantId, w.Insert.Path
+	case w.Update != nil:
+		return w.Update.Scope, w.Update.TenantId, w.Update.Path
+	case w.Delete != nil:
+		return w.Delete.Scope, w.Delete.TenantId, w.Delete.Path
+	case w.UpdateTTL != nil:
+		return w.UpdateTTL.Scope, w.UpdateTTL.TenantId, w.UpdateTTL.Path
+	default:
+		return "", "", ""
+	}
+}
+
+func (m *MemoryServiceClient) applyWrite(service string, write TransactionWrite) error {
+	switch {
+	case write.Insert != nil:
+		return m.insertData(service, *write.Insert)
+	case write.Update != nil:
+		return m.updateData(service, *write.Update)
+	case write.Delete != nil:
+		return m.deleteData(service, *write.Delete)
+	case write.UpdateTTL != nil:
+		return m.updateTTL(service, *write.UpdateTTL)
+	default:
+		return ErrBadRequest.Wrap(fmt.Errorf("empty transaction write"))
+	}
+}
+
+func (m *MemoryServiceClient) AcquireLock(sessionId string, req AcquireLockRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lock := m.state.Locks[req.Key]
+	if lock != nil && lock.Owner != sessionId && lock.ExpiresAt > m.clock().Unix() {
+		return sdk.ErrConflict
+	}
+
+	m.state.Locks[req.Key] = &memoryLock{
+		Owner:     sessionId,
+		ExpiresAt: req.TTL,
+	}
+	return nil
+}
+
+func (m *MemoryServiceClient) ReleaseLock(sessionId string, req ReleaseLockRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lock := m.state.Locks[req.Key]
+	if lock != nil && lock.Owner != sessionId && lock.ExpiresAt > m.clock().Unix() {
+		return sdk.ErrConflict
+	}
+
+	delete(m.state.Locks, req.Key)
+	return nil
+}
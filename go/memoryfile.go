@@ -0,0 +1,235 @@
+package runtime
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const folderMetaFile = "_folder.meta"
+
+type memoryFile struct {
+	Service  string        `json:"service"`
+	Scope    sdk.DataScope `json:"scope"`
+	TenantId string        `json:"tenantId"`
+	Path     string        `json:"path"`
+	Content  string        `json:"content"`
+	Created  time.Time     `json:"created"`
+	Modified time.Time     `json:"modified"`
+}
+
+func (f *memoryFile) metadata() sdk.FileMetaData {
+	size := int64(base64.StdEncoding.DecodedLen(len(f.Content)))
+	if decoded, err := base64.StdEncoding.DecodeString(f.Content); err == nil {
+		size = int64(len(decoded))
+	}
+
+	return sdk.FileMetaData{
+		Name:     fileName(f.Path),
+		Created:  f.Created,
+		Modified: f.Modified,
+		Size:     size,
+	}
+}
+
+func fileName(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+func fileDir(path string) string {
+	idx := strings.LastIndex(path, "/")
+	if idx < 0 {
+		return ""
+	}
+	return path[:idx]
+}
+
+func (m *MemoryServiceClient) putFile(service string, scope sdk.DataScope, tenantId string, path string, content string) {
+	key := storeKey(service, scope, tenantId, path)
+	now := m.clock()
+
+	file := m.state.Files[key]
+	if file == nil {
+		file = &memoryFile{
+			Service:  service,
+			Scope:    scope,
+			TenantId: tenantId,
+			Path:     path,
+			Created:  now,
+		}
+		m.state.Files[key] = file
+	}
+	file.Content = content
+	file.Modified = now
+}
+
+func (m *MemoryServiceClient) ReadFileContent(sessionId string, req ReadFileContentRequest) (ReadFileContentResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file := m.state.Files[storeKey(m.owner(sessionId, req.Scope), req.Scope, req.TenantId, req.Path)]
+	if file == nil {
+		return ReadFileContentResponse{}, sdk.ErrNotFound
+	}
+
+	return ReadFileContentResponse{
+		Content: file.Content,
+	}, nil
+}
+
+func (m *MemoryServiceClient) GetFile(sessionId string, req GetFileRequest) (GetFileResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file := m.state.Files[storeKey(m.owner(sessionId, req.Scope), req.Scope, req.TenantId, req.Path)]
+	if file == nil {
+		return GetFileResponse{}, sdk.ErrNotFound
+	}
+
+	return GetFileResponse{
+		Path:     file.Path,
+		Metadata: file.metadata(),
+	}, nil
+}
+
+func (m *MemoryServiceClient) PutFile(sessionId string, req PutFileRequest) error {
+	content := req.Content
+	if req.LocalFilePath != "" {
+		data, err := os.ReadFile(req.LocalFilePath)
+		if err != nil {
+			return err
+		}
+		content = base64.StdEncoding.EncodeToString(data)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.putFile(m.owner(sessionId, req.Scope), req.Scope, req.TenantId, req.Path, content)
+	return nil
+}
+
+func (m *MemoryServiceClient) DeleteFile(sessionId string, req DeleteFileRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := storeKey(m.owner(sessionId, req.Scope), req.Scope, req.TenantId, req.Path)
+	if m.state.Files[key] == nil {
+		return sdk.ErrNotFound
+	}
+
+	delete(m.state.Files, key)
+	return nil
+}
+
+func (m *MemoryServiceClient) RenameFile(sessionId string, req RenameFileRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	service := m.owner(sessionId, req.Scope)
+	oldKey := storeKey(service, req.Scope, req.TenantId, req.OldPath)
+	file := m.state.Files[oldKey]
+	if file == nil {
+		return sdk.ErrNotFound
+	}
+
+	// a bare name renames the file within its current folder
+	newPath := req.NewPath
+	if !strings.Contains(newPath, "/") {
+		newPath = fileDir(req.OldPath) + "/" + newPath
+	}
+
+	newKey := storeKey(service, req.Scope, req.TenantId, newPath)
+	if m.state.Files[newKey] != nil {
+		return sdk.ErrAlreadyExist
+	}
+
+	delete(m.state.Files, oldKey)
+	file.Path = newPath
+	file.Modified = m.clock()
+	m.state.Files[newKey] = file
+	return nil
+}
+
+func (m *MemoryServiceClient) GetFileDownloadLink(sessionId string, req GetFileRequest) (GetLinkResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.state.Files[storeKey(m.owner(sessionId, req.Scope), req.Scope, req.TenantId, req.Path)] == nil {
+		return GetLinkResponse{}, sdk.ErrNotFound
+	}
+
+	return GetLinkResponse{
+		Link: fmt.Sprintf("memory://%s/%s%s", req.Scope, req.TenantId, req.Path),
+	}, nil
+}
+
+func (m *MemoryServiceClient) GetFileUploadLink(sessionId string, req GetFileRequest) (GetLinkResponse, error) {
+	return GetLinkResponse{
+		Link: fmt.Sprintf("memory://%s/%s%s", req.Scope, req.TenantId, req.Path),
+	}, nil
+}
+
+func (m *MemoryServiceClient) ListFolder(sessionId string, req ListFolderRequest) (ListFolderResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	service := m.owner(sessionId, req.Scope)
+	var files []*memoryFile
+	for _, file := range m.state.Files {
+		if file.Service != service || file.Scope != req.Scope || file.TenantId != req.TenantId {
+			continue
+		}
+		if fileDir(file.Path) != req.FolderPath || fileName(file.Path) == folderMetaFile {
+			continue
+		}
+		files = append(files, file)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	offset := 0
+	if req.OffsetToken != nil {
+		var err error
+		offset, err = strconv.Atoi(*req.OffsetToken)
+		if err != nil || offset < 0 {
+			return ListFolderResponse{}, ErrBadRequest.Wrap(fmt.Errorf("invalid offset token %s", *req.OffsetToken))
+		}
+	}
+
+	limit := int(req.Limit)
+	if limit <= 0 || limit > memoryPageSize {
+		limit = memoryPageSize
+	}
+
+	res := ListFolderResponse{
+		Files: make([]GetFileResponse, 0),
+	}
+	for i := offset; i < len(files) && i < offset+limit; i++ {
+		res.Files = append(res.Files, GetFileResponse{
+			Path:     files[i].Path,
+			Metadata: files[i].metadata(),
+		})
+	}
+
+	if offset+limit < len(files) {
+		token := strconv.Itoa(offset + limit)
+		res.NextToken = &token
+	}
+	return res, nil
+}
+
+func (m *MemoryServiceClient) CreateFolder(sessionId string, req CreateFolderRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.putFile(m.owner(sessionId, req.Scope), req.Scope, req.TenantId, req.FolderPath+"/"+folderMetaFile, "")
+	return nil
+}
@@ -0,0 +1,454 @@
+package runtime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// memoryFilter evaluates query filter expressions against in-memory documents.
+// Supported syntax: comparisons (=, ==, !=, <>, <, <=, >, >=) and IN lists between
+// fields, ? placeholders and literals, combined with AND, OR, NOT and parentheses.
+type memoryFilter struct {
+	root filterNode
+}
+
+type filterNode interface {
+	eval(doc map[string]interface{}) (bool, error)
+}
+
+type filterOperand struct {
+	field string
+	value any
+}
+
+func (o filterOperand) resolve(doc map[string]interface{}) any {
+	if o.field == "" {
+		return o.value
+	}
+	return lookupField(doc, o.field)
+}
+
+// lookupField resolves a dot separated path inside a document.
+func lookupField(doc map[string]interface{}, path string) any {
+	var current any = doc
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[part]
+	}
+	return current
+}
+
+type filterLogical struct {
+	op    string
+	left  filterNode
+	right filterNode
+}
+
+func (n filterLogical) eval(doc map[string]interface{}) (bool, error) {
+	left, err := n.left.eval(doc)
+	if err != nil {
+		return false, err
+	}
+
+	if n.op == "AND" && !left {
+		return false, nil
+	} else if n.op == "OR" && left {
+		return true, nil
+	}
+	return n.right.eval(doc)
+}
+
+type filterNot struct {
+	node filterNode
+}
+
+func (n filterNot) eval(doc map[string]interface{}) (bool, error) {
+	ret, err := n.node.eval(doc)
+	return !ret, err
+}
+
+type filterCompare struct {
+	op    string
+	left  filterOperand
+	right filterOperand
+}
+
+func (n filterCompare) eval(doc map[string]interface{}) (bool, error) {
+	left := n.left.resolve(doc)
+	right := n.right.resolve(doc)
+
+	switch n.op {
+	case "=", "==":
+		return compareValues(left, right) == 0, nil
+	case "!=", "<>":
+		return compareValues(left, right) != 0, nil
+	}
+
+	c := compareValues(left, right)
+	if c == incomparable {
+		return false, nil
+	}
+
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	default:
+		return false, fmt.Errorf("unsupported operator %s", n.op)
+	}
+}
+
+type filterIn struct {
+	left   filterOperand
+	values []filterOperand
+}
+
+func (n filterIn) eval(doc map[string]interface{}) (bool, error) {
+	left := n.left.resolve(doc)
+	for _, operand := range n.values {
+		value := operand.resolve(doc)
+		if list, ok := value.([]interface{}); ok && operand.field == "" {
+			for _, item := range list {
+				if compareValues(left, item) == 0 {
+					return true, nil
+				}
+			}
+		} else if compareValues(left, value) == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type filterAll struct {
+}
+
+func (n filterAll) eval(doc map[string]interface{}) (bool, error) {
+	return true, nil
+}
+
+const incomparable = 2
+
+// compareValues orders two json values, returning incomparable when their types differ.
+func compareValues(a any, b any) int {
+	if a == nil || b == nil {
+		if a == nil && b == nil {
+			return 0
+		}
+		return incomparable
+	}
+
+	switch av := a.(type) {
+	case float64:
+		bv, ok := b.(float64)
+		if !ok {
+			return incomparable
+		}
+		if av < bv {
+			return -1
+		} else if av > bv {
+			return 1
+		}
+		return 0
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			return incomparable
+		}
+		return strings.Compare(av, bv)
+	case bool:
+		bv, ok := b.(bool)
+		if !ok || av != bv {
+			return incomparable
+		}
+		return 0
+	default:
+		if fmt.Sprint(a) == fmt.Sprint(b) {
+			return 0
+		}
+		return incomparable
+	}
+}
+
+func (f memoryFilter) match(doc map[string]interface{}) (bool, error) {
+	return f.root.eval(doc)
+}
+
+func parseMemoryFilter(expr string, args []interface{}) (memoryFilter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return memoryFilter{root: filterAll{}}, nil
+	}
+
+	// normalize args to their json form so they compare like stored documents
+	var normalized []interface{}
+	err := ConvertType(args, &normalized)
+	if err != nil {
+		return memoryFilter{}, err
+	}
+
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return memoryFilter{}, err
+	}
+
+	p := &filterParser{tokens: tokens, args: normalized}
+	root, err := p.parseOr()
+	if err != nil {
+		return memoryFilter{}, err
+	}
+	if p.pos < len(p.tokens) {
+		return memoryFilter{}, fmt.Errorf("unexpected token %s in filter", p.tokens[p.pos].text)
+	}
+	if p.argPos != len(p.args) {
+		return memoryFilter{}, fmt.Errorf("filter expects %d args, got %d", p.argPos, len(p.args))
+	}
+
+	return memoryFilter{root: root}, nil
+}
+
+const (
+	tokenIdent = iota
+	tokenNumber
+	tokenString
+	tokenPlaceholder
+	tokenOperator
+	tokenPunct
+)
+
+type filterToken struct {
+	kind int
+	text string
+}
+
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '?':
+			tokens = append(tokens, filterToken{kind: tokenPlaceholder, text: "?"})
+			i++
+		case r == '(' || r == ')' || r == ',':
+			tokens = append(tokens, filterToken{kind: tokenPunct, text: string(r)})
+			i++
+		case strings.ContainsRune("=!<>", r):
+			j := i + 1
+			if j < len(runes) && strings.ContainsRune("=>", runes[j]) {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: tokenOperator, text: string(runes[i:j])})
+			i = j
+		case r == '\'' || r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				j++
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string in filter")
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, text: string(runes[i+1 : j])})
+			i = j + 1
+		case unicode.IsDigit(r) || r == '-':
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: tokenNumber, text: string(runes[i:j])})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: tokenIdent, text: string(runes[i:j])})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q in filter", r)
+		}
+	}
+
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+	args   []interface{}
+	argPos int
+}
+
+func (p *filterParser) peek() (filterToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *filterParser) keyword(word string) bool {
+	tok, ok := p.peek()
+	if ok && tok.kind == tokenIdent && strings.EqualFold(tok.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) punct(text string) bool {
+	tok, ok := p.peek()
+	if ok && tok.kind == tokenPunct && tok.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = filterLogical{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = filterLogical{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (filterNode, error) {
+	if p.keyword("NOT") {
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return filterNot{node: node}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	if p.punct("(") {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.punct(")") {
+			return nil, fmt.Errorf("missing closing parenthesis in filter")
+		}
+		return node, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.keyword("IN") {
+		if !p.punct("(") {
+			operand, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return filterIn{left: left, values: []filterOperand{operand}}, nil
+		}
+
+		var values []filterOperand
+		for {
+			operand, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, operand)
+
+			if p.punct(")") {
+				break
+			} else if !p.punct(",") {
+				return nil, fmt.Errorf("expected , or ) in filter")
+			}
+		}
+		return filterIn{left: left, values: values}, nil
+	}
+
+	tok, ok := p.peek()
+	if !ok || tok.kind != tokenOperator {
+		return nil, fmt.Errorf("expected comparison operator in filter")
+	}
+	p.pos++
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return filterCompare{op: tok.text, left: left, right: right}, nil
+}
+
+func (p *filterParser) parseOperand() (filterOperand, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return filterOperand{}, fmt.Errorf("unexpected end of filter")
+	}
+	p.pos++
+
+	switch tok.kind {
+	case tokenPlaceholder:
+		if p.argPos >= len(p.args) {
+			return filterOperand{}, fmt.Errorf("missing arg %d for filter", p.argPos)
+		}
+		value := p.args[p.argPos]
+		p.argPos++
+		return filterOperand{value: value}, nil
+	case tokenString:
+		return filterOperand{value: tok.text}, nil
+	case tokenNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return filterOperand{}, fmt.Errorf("invalid number %s in filter", tok.text)
+		}
+		return filterOperand{value: value}, nil
+	case tokenIdent:
+		switch strings.ToLower(tok.text) {
+		case "true":
+			return filterOperand{value: true}, nil
+		case "false":
+			return filterOperand{value: false}, nil
+		case "null":
+			return filterOperand{value: nil}, nil
+		}
+		return filterOperand{field: tok.text}, nil
+	default:
+		return filterOperand{}, fmt.Errorf("unexpected token %s in filter", tok.text)
+	}
+}
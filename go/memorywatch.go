@@ -0,0 +1,58 @@
+package runtime
+
+import (
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+// recordChange buffers a document change until the write that caused it is published.
+func (m *MemoryServiceClient) recordChange(changeType sdk.ChangeType, doc *memoryDocument, oldData map[string]interface{}, newData map[string]interface{}) {
+	m.changes = append(m.changes, sdk.ChangeEvent{
+		Type:       changeType,
+		Scope:      doc.Scope,
+		TenantId:   doc.TenantId,
+		Collection: fileName(doc.CollectionPath),
+		Path:       doc.Path,
+		Version:    doc.Version,
+		OldData:    oldData,
+		NewData:    newData,
+	})
+}
+
+// publishChanges starts a task for every watcher of the buffered changes. Changes to service
+// collections are only delivered to the service that made them. A write made while its task
+// replays the journal was published when it first ran, so it is not delivered again.
+func (m *MemoryServiceClient) publishChanges(sessionId string) {
+	changes := m.changes
+	m.changes = nil
+
+	writer := ""
+	if task := m.state.Tasks[sessionId]; task != nil {
+		if task.Cursor < len(task.Steps) {
+			return
+		}
+		writer = task.Service.Service
+	}
+
+	for _, change := range changes {
+		for _, service := range m.state.App.Services {
+			if change.Scope == sdk.DataScopeService && service.Name != writer {
+				continue
+			}
+
+			for _, collection := range service.Collections {
+				if collection.Name != change.Collection {
+					continue
+				}
+
+				for _, method := range collection.Watchers {
+					task := m.newServiceTask(ServiceStartEvent{
+						Service: service.Name,
+						Method:  method,
+						Input:   change,
+					}, "")
+					m.state.Pending = append(m.state.Pending, task.SessionId)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+// UpgradeFunc moves the json form of a document one schema version forward, changing data in place
+type UpgradeFunc func(data map[string]interface{}) error
+
+// WithSchemaVersion sets the current schema version of the model, documents are written with it
+// and older ones are upgraded to it when read. Models start at version 1.
+func WithSchemaVersion(version int) RegisterOption {
+	return func(cfg *RegisterConfig) {
+		cfg.schemaVersion = version
+	}
+}
+
+// WithUpgrade registers fn to move documents from schema version from to from+1
+func WithUpgrade(from int, fn UpgradeFunc) RegisterOption {
+	return func(cfg *RegisterConfig) {
+		cfg.upgrades[from] = fn
+	}
+}
+
+func validateUpgrades(schemaVersion int, upgrades map[int]UpgradeFunc) error {
+	if schemaVersion < 1 {
+		return fmt.Errorf("invalid schema version %d", schemaVersion)
+	}
+
+	for from := range upgrades {
+		if from < 1 || from >= schemaVersion {
+			return fmt.Errorf("upgrade from version %d is outside schema version %d", from, schemaVersion)
+		}
+	}
+	for from := 1; from < schemaVersion; from++ {
+		if upgrades[from] == nil {
+			return fmt.Errorf("missing upgrade from version %d", from)
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the current schema version of the collection, 0 when it is not registered
+func (m *ModelRegistry) SchemaVersion(collection string) int {
+	model := m.models[collection]
+	if model == nil {
+		return 0
+	}
+	return model.schemaVersion
+}
+
+// Upgrade runs the upgrades of the collection on a copy of data stored with schemaVersion, documents
+// written before versioning count as version 1. It returns the data and the version it is now at.
+func (m *ModelRegistry) Upgrade(collection string, schemaVersion int, data map[string]interface{}) (map[string]interface{}, int, error) {
+	model := m.models[collection]
+	if schemaVersion < 1 {
+		schemaVersion = 1
+	}
+	if model == nil || schemaVersion >= model.schemaVersion {
+		return data, schemaVersion, nil
+	}
+
+	upgraded, err := copyData(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for ; schemaVersion < model.schemaVersion; schemaVersion++ {
+		err = model.upgrades[schemaVersion](upgraded)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to upgrade %s from version %d: %w", collection, schemaVersion, err)
+		}
+	}
+	return upgraded, schemaVersion, nil
+}
+
+func (r *ReadOnlyDoc) upgrade() error {
+	// upgrades expect the whole document, selected fields are returned as stored
+	if r.projected {
+		return nil
+	}
+
+	item, schemaVersion, err := r.modelRegistry.Upgrade(r.collection, r.schemaVersion, r.item)
+	if err != nil {
+		return err
+	}
+
+	r.item = item
+	r.schemaVersion = schemaVersion
+	return nil
+}
+
+func (d *Doc) upgrade() error {
+	// upgrades expect the whole document, selected fields are returned as stored
+	if d.projected {
+		return nil
+	}
+
+	item, schemaVersion, err := d.modelRegistry.Upgrade(d.collection, d.schemaVersion, d.item)
+	if err != nil {
+		return err
+	}
+
+	d.item = item
+	d.schemaVersion = schemaVersion
+	return nil
+}
+
+// Migrate upgrades every document of the collection stored with an older schema version and
+// writes it back. Documents changed while the migration runs are skipped, they are upgraded on
+// their next read. It returns the number of documents written.
+func (c *Collection) Migrate(ctx context.Context) (int, error) {
+	schemaVersion := c.modelRegistry.SchemaVersion(c.name)
+	if schemaVersion == 0 {
+		return 0, fmt.Errorf("collection %s is not registered", c.Path())
+	}
+
+	var stale []GetDataResponse
+	err := queryAll(ctx, c.client, c.sessionId, QueryDataRequest{
+		Scope:          c.scope,
+		TenantId:       c.tenantId,
+		CollectionPath: c.Path(),
+	}, func(item GetDataResponse) bool {
+		if max(item.SchemaVersion, 1) < schemaVersion {
+			stale = append(stale, item)
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, item := range stale {
+		data, _, err := c.modelRegistry.Upgrade(c.name, item.SchemaVersion, item.Data)
+		if err != nil {
+			return migrated, err
+		}
+
+		_, err = c.client.UpdateData(c.sessionId, UpdateDataRequest{
+			Scope:         c.scope,
+			TenantId:      c.tenantId,
+			Path:          item.Path,
+			Item:          data,
+			SchemaVersion: schemaVersion,
+			Cfg: sdk.WriteConfig{
+				VersionEquals: item.Version,
+			},
+		})
+		if sdk.IsError(err, sdk.ErrConflict) {
+			continue
+		} else if err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
@@ -0,0 +1,129 @@
+package runtime
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+func TestMigration_CollectionsSharingATypeKeepTheirModels(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Put": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				doc, err := ctx.Db().Get().AppCollection(input.Name).InsertOne("new", &testItem{Name: "new"})
+				if err != nil {
+					return nil, err
+				}
+				return doc.(*Doc).schemaVersion, nil
+			},
+			"Get": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				doc, err := ctx.Db().Get().AppCollection(input.Name).GetOne("old")
+				if err != nil {
+					return nil, err
+				}
+
+				var item testItem
+				err = doc.Unmarshal(&item)
+				return item.Count, err
+			},
+		},
+	})
+
+	registry := GetModelRegistry("store")
+	err := registry.Register("orders", &testItem{})
+	if err != nil {
+		t.Fatalf("failed to register orders: %s", err.Error())
+	}
+	err = registry.Register("archive", &testItem{}, WithSchemaVersion(2), WithUpgrade(1, func(data map[string]interface{}) error {
+		data["count"] = 100
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed to register archive: %s", err.Error())
+	}
+	startTestApp(t, client)
+
+	for _, collection := range []string{"orders", "archive"} {
+		_, err = client.InsertData("", InsertDataRequest{
+			Scope:          sdk.DataScopeApp,
+			Path:           collection + "/old",
+			CollectionPath: collection,
+			Item:           map[string]interface{}{"name": "old", "count": 1},
+			SchemaVersion:  1,
+		})
+		if err != nil {
+			t.Fatalf("failed to seed %s: %s", collection, err.Error())
+		}
+	}
+
+	expected := map[string][2]int{"orders": {1, 1}, "archive": {2, 100}}
+	for collection, want := range expected {
+		var schemaVersion, count int
+		mustOutput(t, runService(client, "store", "Put", testInput{Name: collection}), &schemaVersion)
+		mustOutput(t, runService(client, "store", "Get", testInput{Name: collection}), &count)
+		if schemaVersion != want[0] || count != want[1] {
+			t.Fatalf("expected %s at schema version %d reading count %d, got %d and %d", collection, want[0], want[1], schemaVersion, count)
+		}
+	}
+}
+
+func TestMigration_PatchesUpgradeOldDocuments(t *testing.T) {
+	// patch patches the document id of items, inside a transaction when input.Count is set
+	patch := func(db sdk.DataStore, id string) error {
+		doc, err := db.AppCollection("items").GetOne(id)
+		if err != nil {
+			return err
+		}
+		return doc.Patch([]sdk.PatchOp{sdk.Set("name", "patched"), sdk.Increment("count", 1)})
+	}
+
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Patch": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				if input.Count == 0 {
+					return nil, patch(ctx.Db().Get(), input.Name)
+				}
+				return nil, ctx.Db().Get().Transaction(func(tx sdk.DataStore) error {
+					return patch(tx, input.Name)
+				})
+			},
+		},
+	})
+
+	// version 1 kept the name in title
+	err := GetModelRegistry("store").Register("items", &testItem{}, WithSchemaVersion(2), WithUpgrade(1, func(data map[string]interface{}) error {
+		data["name"] = data["title"]
+		delete(data, "title")
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed to register items: %s", err.Error())
+	}
+	startTestApp(t, client)
+
+	for i, id := range []string{"old", "old-tx"} {
+		_, err = client.InsertData("", InsertDataRequest{
+			Scope:          sdk.DataScopeApp,
+			Path:           "items/" + id,
+			CollectionPath: "items",
+			Item:           map[string]interface{}{"title": id, "count": 1},
+			SchemaVersion:  1,
+		})
+		if err != nil {
+			t.Fatalf("failed to seed %s: %s", id, err.Error())
+		}
+
+		mustRun(t, client, "store", "Patch", testInput{Name: id, Count: i})
+
+		data, err := client.GetData("", GetDataRequest{Scope: sdk.DataScopeApp, Path: "items/" + id})
+		if err != nil {
+			t.Fatalf("failed to read %s: %s", id, err.Error())
+		}
+		if data.SchemaVersion != 2 || fmt.Sprint(data.Data) != "map[count:2 name:patched]" {
+			t.Fatalf("expected %s upgraded before the patch, got version %d %v", id, data.SchemaVersion, data.Data)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package runtime
+
+import (
+	"fmt"
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+	"strings"
+)
+
+// applyPatch applies patch operations in order to a document holding json values.
+func applyPatch(data map[string]interface{}, ops []sdk.PatchOp) error {
+	for _, op := range ops {
+		if op.Path == "" {
+			return ErrBadRequest.Wrap(fmt.Errorf("patch %s without a path", op.Op))
+		}
+
+		current := lookupField(data, op.Path)
+		switch op.Op {
+		case sdk.PatchSet:
+			setField(data, op.Path, op.Value)
+		case sdk.PatchSetIfAbsent:
+			if current == nil {
+				setField(data, op.Path, op.Value)
+			}
+		case sdk.PatchUnset:
+			unsetField(data, op.Path)
+		case sdk.PatchIncrement:
+			delta, ok := op.Value.(float64)
+			if !ok {
+				return ErrBadRequest.Wrap(fmt.Errorf("increment of %s by a non numeric value", op.Path))
+			}
+
+			value, ok := current.(float64)
+			if current != nil && !ok {
+				return ErrBadRequest.Wrap(fmt.Errorf("increment of non numeric field %s", op.Path))
+			}
+			setField(data, op.Path, value+delta)
+		case sdk.PatchAppend, sdk.PatchRemove:
+			values, ok := op.Value.([]interface{})
+			if !ok {
+				return ErrBadRequest.Wrap(fmt.Errorf("%s on %s expects a list of values", op.Op, op.Path))
+			}
+
+			list, ok := current.([]interface{})
+			if current != nil && !ok {
+				return ErrBadRequest.Wrap(fmt.Errorf("%s on non array field %s", op.Op, op.Path))
+			}
+
+			if op.Op == sdk.PatchAppend {
+				list = append(list, values...)
+			} else {
+				list = removeValues(list, values)
+			}
+			setField(data, op.Path, list)
+		default:
+			return ErrBadRequest.Wrap(fmt.Errorf("unsupported patch %s", op.Op))
+		}
+	}
+	return nil
+}
+
+func unsetField(data map[string]interface{}, path string) {
+	parts := strings.Split(path, ".")
+	current := data
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			return
+		}
+		current = next
+	}
+	delete(current, parts[len(parts)-1])
+}
+
+func removeValues(list []interface{}, values []interface{}) []interface{} {
+	kept := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		removed := false
+		for _, value := range values {
+			if compareValues(item, value) == 0 {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,58 @@
+package runtime
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+func TestDoc_PatchIgnoresStaleVersion(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Put": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				_, err := ctx.Db().Get().ServiceCollection("items").InsertOne(input.Name, &testItem{Name: input.Name})
+				return nil, err
+			},
+			"Increment": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				items := ctx.Db().Get().ServiceCollection("items")
+				first, err := items.GetOne(input.Name)
+				if err != nil {
+					return nil, err
+				}
+				second, err := items.GetOne(input.Name)
+				if err != nil {
+					return nil, err
+				}
+
+				for _, doc := range []sdk.Doc{first, second} {
+					err = doc.Patch([]sdk.PatchOp{sdk.Increment("count", 1)})
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				err = first.Patch([]sdk.PatchOp{sdk.Increment("count", 1)}, sdk.WithVersionEquals(first.Version()-1))
+				if !sdk.IsError(err, sdk.ErrConflict) {
+					return nil, fmt.Errorf("expected a conflict for a stale version, got %v", err)
+				}
+
+				var item testItem
+				err = second.Unmarshal(&item)
+				return item.Count, err
+			},
+		},
+	})
+
+	evt := runService(client, "store", "Put", testInput{Name: "a"})
+	if evt.IsError {
+		t.Fatalf("put failed: %s", evt.Error.Error())
+	}
+
+	var count int
+	mustOutput(t, runService(client, "store", "Increment", testInput{Name: "a"}), &count)
+	if count != 2 {
+		t.Fatalf("expected both increments to apply, got %d", count)
+	}
+}
@@ -0,0 +1,145 @@
+package runtime
+
+import (
+	"fmt"
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+// refRequests checks the references and turns them into reads, failing on the first invalid one
+func refRequests(refs []sdk.DocRef) ([]GetDataRequest, error) {
+	reqs := make([]GetDataRequest, 0, len(refs))
+	for _, ref := range refs {
+		err := ref.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		reqs = append(reqs, GetDataRequest{
+			Scope:    ref.Scope,
+			TenantId: ref.TenantId,
+			Path:     ref.Path,
+		})
+	}
+	return reqs, nil
+}
+
+func getMany(client ServiceClient, sessionId string, refs []sdk.DocRef) ([]GetDataResponse, error) {
+	reqs, err := refRequests(refs)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.GetMany(sessionId, GetManyRequest{
+		Items: reqs,
+	})
+	if err != nil {
+		return nil, err
+	} else if len(res.Items) != len(refs) {
+		return nil, fmt.Errorf("resolved %d documents for %d references", len(res.Items), len(refs))
+	}
+
+	for i, item := range res.Items {
+		if item.Exist && item.Path != refs[i].Path {
+			return nil, fmt.Errorf("reference %s resolved to %s", refs[i], item.Path)
+		}
+	}
+	return res.Items, nil
+}
+
+func (r *ReadOnlyDataStore) Resolve(ref sdk.DocRef) (sdk.ReadOnlyDoc, error) {
+	docs, err := r.ResolveMany([]sdk.DocRef{ref})
+	if err != nil {
+		return nil, err
+	} else if docs[0] == nil {
+		return nil, sdk.ErrNotFound
+	}
+	return docs[0], nil
+}
+
+func (r *ReadOnlyDataStore) ResolveMany(refs []sdk.DocRef) ([]sdk.ReadOnlyDoc, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	items, err := getMany(r.client, r.sessionId, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]sdk.ReadOnlyDoc, 0, len(items))
+	for i, data := range items {
+		if !data.Exist {
+			docs = append(docs, nil)
+			continue
+		}
+
+		docs = append(docs, &ReadOnlyDoc{
+			client:    r.client,
+			sessionId: r.sessionId,
+			tenantId:  refs[i].TenantId,
+			scope:     refs[i].Scope,
+			path:      refs[i].Path,
+			version:   data.Version,
+			item:      data.Data,
+			createdAt: data.CreatedAt,
+			updatedAt: data.UpdatedAt,
+			expiresAt: data.ExpiresAt,
+
+			schemaVersion: data.SchemaVersion,
+
+			modelRegistry: r.modelRegistry,
+			collection:    fileName(refs[i].Collection()),
+			typeName:      r.modelRegistry.Get(fileName(refs[i].Collection())).TypeName,
+		})
+	}
+	return docs, nil
+}
+
+func (d *DataStore) Resolve(ref sdk.DocRef) (sdk.Doc, error) {
+	docs, err := d.ResolveMany([]sdk.DocRef{ref})
+	if err != nil {
+		return nil, err
+	} else if docs[0] == nil {
+		return nil, sdk.ErrNotFound
+	}
+	return docs[0], nil
+}
+
+func (d *DataStore) ResolveMany(refs []sdk.DocRef) ([]sdk.Doc, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	items, err := getMany(d.client, d.sessionId, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]sdk.Doc, 0, len(items))
+	for i, data := range items {
+		if !data.Exist {
+			docs = append(docs, nil)
+			continue
+		}
+
+		docs = append(docs, &Doc{
+			client:    d.client,
+			sessionId: d.sessionId,
+			tenantId:  refs[i].TenantId,
+			scope:     refs[i].Scope,
+			path:      refs[i].Path,
+			version:   data.Version,
+			item:      data.Data,
+			createdAt: data.CreatedAt,
+			updatedAt: data.UpdatedAt,
+			expiresAt: data.ExpiresAt,
+
+			schemaVersion: data.SchemaVersion,
+
+			modelRegistry: d.modelRegistry,
+			collection:    fileName(refs[i].Collection()),
+			typeName:      d.modelRegistry.Get(fileName(refs[i].Collection())).TypeName,
+		})
+	}
+	return docs, nil
+}
@@ -0,0 +1,126 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+type testOrder struct {
+	Account sdk.DocRef `json:"account"`
+	Profile sdk.DocRef `json:"profile"`
+}
+
+func TestDataStore_ResolveRefs(t *testing.T) {
+	accountRef := sdk.Ref(sdk.DataScopeApp, "tenant-b", "accounts", "acc-1")
+	profileRef := sdk.Ref(sdk.DataScopeService, "", "profiles", "p-1")
+
+	// resolveNames resolves the refs and returns the names of the documents, "-" for missing ones
+	resolveNames := func(db sdk.DataStore, refs ...sdk.DocRef) ([]string, error) {
+		docs, err := db.ResolveMany(refs)
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for _, doc := range docs {
+			if doc == nil {
+				names = append(names, "-")
+				continue
+			}
+
+			var item testItem
+			err = doc.Unmarshal(&item)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, item.Name)
+		}
+		return names, nil
+	}
+
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Seed": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				account, err := ctx.Db().WithTenantId("tenant-b").Get().AppCollection("accounts").InsertOne("acc-1", &testItem{Name: "account"})
+				if err != nil {
+					return nil, err
+				}
+				profile, err := ctx.Db().Get().ServiceCollection("profiles").InsertOne("p-1", &testItem{Name: "profile"})
+				if err != nil {
+					return nil, err
+				}
+				if account.Ref() != accountRef || profile.Ref() != profileRef {
+					return nil, fmt.Errorf("unexpected refs %s %s", account.Ref(), profile.Ref())
+				}
+
+				_, err = ctx.Db().Get().ServiceCollection("orders").InsertOne("o-1", &testOrder{
+					Account: account.Ref(),
+					Profile: profile.Ref(),
+				})
+				return nil, err
+			},
+			"Resolve": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				doc, err := ctx.Db().Get().ServiceCollection("orders").GetOne("o-1")
+				if err != nil {
+					return nil, err
+				}
+				var order testOrder
+				err = doc.Unmarshal(&order)
+				if err != nil {
+					return nil, err
+				}
+
+				missing := sdk.Ref(sdk.DataScopeApp, "tenant-b", "accounts", "acc-2")
+				return resolveNames(ctx.Db().Get(), order.Account, order.Profile, missing)
+			},
+		},
+	}, &testService{
+		name: "other",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Resolve": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				if _, err := ctx.Db().Get().Resolve(profileRef); !sdk.IsError(err, *sdk.ErrNotFound) {
+					return nil, fmt.Errorf("expected another service's profile to be not found, got %v", err)
+				}
+				return resolveNames(ctx.Db().Get(), accountRef)
+			},
+			"Invalid": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				_, err := ctx.Db().Get().Resolve(sdk.Ref(sdk.DataScopeApp, "tenant-b", "accounts"))
+				var validationErr sdk.ValidationError
+				if !errors.As(err, &validationErr) {
+					return nil, fmt.Errorf("expected a validation error, got %v", err)
+				}
+				return validationErr.Violations, nil
+			},
+		},
+	})
+
+	evt := runService(client, "store", "Seed", testInput{})
+	if evt.IsError {
+		t.Fatalf("seed failed: %s", evt.Error.Error())
+	}
+
+	var names []string
+	mustOutput(t, runService(client, "store", "Resolve", testInput{}), &names)
+	if fmt.Sprint(names) != "[account profile -]" {
+		t.Fatalf("unexpected resolved docs %v", names)
+	}
+
+	mustOutput(t, runService(client, "other", "Resolve", testInput{}), &names)
+	if fmt.Sprint(names) != "[account]" {
+		t.Fatalf("unexpected resolved docs %v", names)
+	}
+
+	var violations []sdk.FieldViolation
+	mustOutput(t, runService(client, "other", "Invalid", testInput{}), &violations)
+	if len(violations) != 1 || violations[0].Field != "path" {
+		t.Fatalf("unexpected violations %+v", violations)
+	}
+
+	if err := sdk.Ref("tenant", "", "accounts", "acc-1").Validate(); err == nil {
+		t.Fatal("expected an unknown scope to fail validation")
+	}
+}
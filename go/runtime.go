@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"github.com/cloudimpl/polycode-runtime/go/sdk"
 	"github.com/gin-gonic/gin"
+	"github.com/invopop/jsonschema"
 	"log"
 	"runtime/debug"
+	"sync"
 	"time"
 )
 
@@ -26,6 +28,16 @@ func init() {
 
 type ModelRegistry struct {
 	modelMap map[string]sdk.CollectionDescription
+	models   map[string]*registeredModel
+	strict   bool
+}
+
+// registeredModel holds what the registry needs of a collection to read and write its documents.
+// Models are kept per collection, so collections sharing a type keep their own versions and upgrades.
+type registeredModel struct {
+	schema        *jsonschema.Schema
+	schemaVersion int
+	upgrades      map[int]UpgradeFunc
 }
 
 func (m *ModelRegistry) Get(name string) sdk.CollectionDescription {
@@ -40,7 +52,17 @@ func (m *ModelRegistry) List() []sdk.CollectionDescription {
 	return models
 }
 
-func (m *ModelRegistry) Register(name string, modelType interface{}) error {
+type RegisterConfig struct {
+	indexes       []sdk.IndexDescription
+	schemaVersion int
+	upgrades      map[int]UpgradeFunc
+}
+
+type RegisterOption func(*RegisterConfig)
+
+// Register adds a collection of modelType. Indexes are read from the index struct tags of the
+// model and from opts.
+func (m *ModelRegistry) Register(name string, modelType interface{}, opts ...RegisterOption) error {
 	if !IsPointer(modelType) {
 		return errors.New("provide pointer of the struct to register")
 	}
@@ -56,11 +78,61 @@ func (m *ModelRegistry) Register(name string, modelType interface{}) error {
 		return errors.New("collection already registered")
 	}
 
+	indexes, err := tagIndexes(modelType)
+	if err != nil {
+		return err
+	}
+
+	cfg := &RegisterConfig{
+		indexes:       indexes,
+		schemaVersion: 1,
+		upgrades:      make(map[int]UpgradeFunc),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	err = validateIndexes(modelType, cfg.indexes)
+	if err != nil {
+		return err
+	}
+
+	err = validateUpgrades(cfg.schemaVersion, cfg.upgrades)
+	if err != nil {
+		return err
+	}
+
 	m.modelMap[name] = sdk.CollectionDescription{
-		Name:     name,
-		TypeName: typeName,
-		Schema:   typeSchema,
+		Name:          name,
+		TypeName:      typeName,
+		Schema:        typeSchema,
+		SchemaVersion: cfg.schemaVersion,
+		Indexes:       cfg.indexes,
+	}
+	m.models[name] = &registeredModel{
+		schema:        jsonschema.Reflect(modelType),
+		schemaVersion: cfg.schemaVersion,
+		upgrades:      cfg.upgrades,
+	}
+	return nil
+}
+
+// Watch subscribes method of the owning service to the insert, update and delete events of
+// collection. The method is invoked with a sdk.ChangeEvent for every change.
+func (m *ModelRegistry) Watch(name string, method string) error {
+	collection, ok := m.modelMap[name]
+	if !ok {
+		return fmt.Errorf("collection %s not registered", name)
+	}
+
+	for _, watcher := range collection.Watchers {
+		if watcher == method {
+			return fmt.Errorf("collection %s already watched by %s", name, method)
+		}
 	}
+
+	collection.Watchers = append(collection.Watchers, method)
+	m.modelMap[name] = collection
 	return nil
 }
 
@@ -77,14 +149,21 @@ type ServiceStartEvent struct {
 	Method    string       `json:"method"`
 	Meta      sdk.TaskMeta `json:"meta"`
 	Input     any          `json:"input"`
+	Cancelled bool         `json:"cancelled"`
+}
+
+// TaskCancelEvent asks for a task to be cancelled while it runs in the app
+type TaskCancelEvent struct {
+	TaskId string `json:"taskId"`
 }
 
 type ServiceCompleteEvent struct {
-	IsError    bool           `json:"isError"`
-	Output     any            `json:"output"`
-	Error      sdk.Error      `json:"error"`
-	Stacktrace sdk.Stacktrace `json:"stacktrace"`
-	Logs       []LogMsg       `json:"logs"`
+	IsError     bool           `json:"isError"`
+	IsCancelled bool           `json:"isCancelled"`
+	Output      any            `json:"output"`
+	Error       sdk.Error      `json:"error"`
+	Stacktrace  sdk.Stacktrace `json:"stacktrace"`
+	Logs        []LogMsg       `json:"logs"`
 }
 
 type ApiStartEvent struct {
@@ -113,6 +192,7 @@ type Runtime interface {
 	GetValidator() sdk.Validator
 	RunService(ctx context.Context, event ServiceStartEvent) (evt ServiceCompleteEvent)
 	RunApi(ctx context.Context, event ApiStartEvent) (evt ApiCompleteEvent)
+	CancelTask(event TaskCancelEvent) error
 	Start() error
 }
 
@@ -124,6 +204,39 @@ type ClientRuntime struct {
 	modelMap    map[string]*ModelRegistry
 	httpHandler *gin.Engine
 	validator   sdk.Validator
+	running     *runningTasks
+}
+
+// errTaskCancelled is the cause of the context of a task cancelled in flight
+var errTaskCancelled = errors.New("task cancelled")
+
+// runningTasks keeps the cancel functions of the tasks executing in the runtime, by task id
+type runningTasks struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelCauseFunc
+}
+
+func (r *runningTasks) add(taskId string, cancel context.CancelCauseFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancels[taskId] = cancel
+}
+
+func (r *runningTasks) remove(taskId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.cancels, taskId)
+}
+
+func (r *runningTasks) cancel(taskId string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cancel, ok := r.cancels[taskId]
+	if ok {
+		cancel(errTaskCancelled)
+	}
+	return ok
 }
 
 func (c ClientRuntime) getService(serviceName string) (ClientService, error) {
@@ -245,6 +358,17 @@ func (c ClientRuntime) RunService(ctx context.Context, event ServiceStartEvent)
 		return ErrorToServiceComplete(err2, "")
 	}
 
+	// a cancelled task is replayed with a cancelled context so cleanup code can observe ctx.Done(),
+	// a running one has its context cancelled when CancelTask is called for it
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if event.Cancelled {
+		cancel(errTaskCancelled)
+	}
+
+	c.running.add(event.Meta.TaskId, cancel)
+	defer c.running.remove(event.Meta.TaskId)
+
 	ctxImpl := &Context{
 		ctx:           ctx,
 		sessionId:     event.SessionId,
@@ -252,17 +376,36 @@ func (c ClientRuntime) RunService(ctx context.Context, event ServiceStartEvent)
 		modelRegistry: GetModelRegistry(event.Service),
 		meta:          event.Meta,
 		validator:     c.validator,
+		saga:          &saga{},
 	}
 
 	var ret any
+	var compErr error
 	if service.IsWorkflow(event.Method) {
 		fmt.Printf("service %s exec workflow %s with session id %s", event.Service, event.Method, event.SessionId)
 		ret, err = service.ExecuteWorkflow(ctxImpl, event.Method, inputObj)
+		if err != nil || context.Cause(ctx) == errTaskCancelled {
+			compErr = ctxImpl.compensate()
+		}
 	} else {
 		fmt.Printf("service %s exec handler %s with session id %s", event.Service, event.Method, event.SessionId)
 		ret, err = service.ExecuteService(ctxImpl, event.Method, inputObj)
 	}
 
+	if context.Cause(ctx) == errTaskCancelled {
+		fmt.Printf("service %s cancelled %s\n", event.Service, event.Method)
+		cancelErr := sdk.ErrTaskCancelled.With(event.Meta.TaskId)
+		if compErr != nil {
+			cancelErr = cancelErr.Wrap(compErr)
+		}
+		return CancelToServiceComplete(cancelErr)
+	}
+
+	if compErr != nil {
+		// the step error is kept first so callers still see why the workflow failed
+		err = errors.Join(err, compErr)
+	}
+
 	if err != nil {
 		err2 := ErrServiceExecError.Wrap(err)
 		fmt.Printf("failed to execute service %s\n", err.Error())
@@ -348,6 +491,15 @@ func (c ClientRuntime) RunApi(ctx context.Context, event ApiStartEvent) (evt Api
 	}
 }
 
+// CancelTask cancels the context of a task running in the runtime. Tasks that are not running
+// are left to the sidecar, which replays them with a cancelled context.
+func (c ClientRuntime) CancelTask(event TaskCancelEvent) error {
+	if c.running.cancel(event.TaskId) {
+		fmt.Printf("task %s cancelled in flight\n", event.TaskId)
+	}
+	return nil
+}
+
 func RegisterService(service ClientService) error {
 	_, ok := serviceMap[service.GetName()]
 	if ok {
@@ -363,6 +515,7 @@ func GetModelRegistry(serviceName string) *ModelRegistry {
 	if !ok {
 		registry = &ModelRegistry{
 			modelMap: make(map[string]sdk.CollectionDescription),
+			models:   make(map[string]*registeredModel),
 		}
 		modelMap[serviceName] = registry
 	}
@@ -389,15 +542,9 @@ func WithValidator(validator sdk.Validator) StartOption {
 	}
 }
 
-func Start(opts ...StartOption) error {
-	clientEnv, err := initClientEnv()
-	if err != nil {
-		return err
-	}
-
-	serviceClient := NewServiceClient(clientEnv.SidecarApi)
-	apiServer := NewApiServer(clientEnv.AppPort)
-
+// NewClientRuntime creates a runtime for the registered services that talks to the sidecar through client.
+// Pair it with a MemoryServiceClient to run services without a sidecar.
+func NewClientRuntime(client ServiceClient, opts ...StartOption) *ClientRuntime {
 	cfg := &StartConfig{
 		httpHandler: nil,
 		validator:   DummyValidator{},
@@ -406,15 +553,30 @@ func Start(opts ...StartOption) error {
 		opt(cfg)
 	}
 
-	runtime := &ClientRuntime{
-		env:         clientEnv,
-		client:      serviceClient,
-		apiServer:   apiServer,
+	return &ClientRuntime{
+		client:      client,
 		serviceMap:  serviceMap,
 		modelMap:    modelMap,
 		httpHandler: cfg.httpHandler,
 		validator:   cfg.validator,
+		running: &runningTasks{
+			cancels: make(map[string]context.CancelCauseFunc),
+		},
 	}
+}
+
+func Start(opts ...StartOption) error {
+	clientEnv, err := initClientEnv()
+	if err != nil {
+		return err
+	}
+
+	serviceClient := NewServiceClient(clientEnv.SidecarApi)
+	apiServer := NewApiServer(clientEnv.AppPort)
+
+	runtime := NewClientRuntime(serviceClient, opts...)
+	runtime.env = clientEnv
+	runtime.apiServer = apiServer
 
 	err = runtime.Start()
 	if err != nil {
@@ -0,0 +1,101 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+func TestCancelTask_ReplaysWithCancelledContext(t *testing.T) {
+	var taskId string
+	var done, compensated bool
+	client := newTestClient(t, &testService{
+		name: "jobs",
+		workflows: map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error){
+			"Run": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				taskId = ctx.Meta().TaskId
+				err := ctx.CompensateFunc(func() (any, error) {
+					compensated = true
+					return nil, nil
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				_, err = ctx.Signal("go").Await()
+				select {
+				case <-ctx.Done():
+					done = true
+				default:
+				}
+				return nil, err
+			},
+		},
+	})
+
+	runService(client, "jobs", "Run", testInput{})
+	if done || compensated {
+		t.Fatal("workflow observed a cancellation before it was cancelled")
+	}
+
+	err := client.CancelTask(TaskCancelEvent{TaskId: taskId})
+	if err != nil {
+		t.Fatalf("cancel failed: %s", err.Error())
+	}
+	client.RunPending(context.Background())
+
+	if !done || !compensated {
+		t.Fatalf("expected the cancelled workflow to see ctx.Done and compensate, done %v compensated %v", done, compensated)
+	}
+
+	client.mu.Lock()
+	result := client.findTask(taskId).ServiceResult
+	client.mu.Unlock()
+	if result == nil || !result.IsCancelled {
+		t.Fatalf("expected the task to complete as cancelled, got %+v", result)
+	}
+}
+
+func TestCancelTask_CancelsRunningWorkflows(t *testing.T) {
+	started := make(chan string)
+	var compensated bool
+	client := newTestClient(t, &testService{
+		name: "jobs",
+		workflows: map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error){
+			"Run": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				err := ctx.CompensateFunc(func() (any, error) {
+					compensated = true
+					return nil, nil
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				started <- ctx.Meta().TaskId
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(5 * time.Second):
+					return "not cancelled", nil
+				}
+			},
+		},
+	})
+
+	result := make(chan ServiceCompleteEvent)
+	go func() {
+		result <- runService(client, "jobs", "Run", testInput{})
+	}()
+
+	err := client.CancelTask(TaskCancelEvent{TaskId: <-started})
+	if err != nil {
+		t.Fatalf("cancel failed: %s", err.Error())
+	}
+
+	evt := <-result
+	if !evt.IsCancelled || !compensated {
+		t.Fatalf("expected the workflow to be cancelled in flight and compensate, got %+v compensated %v", evt, compensated)
+	}
+}
@@ -0,0 +1,92 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+// compensation is a registered compensation as it is journaled. Functions are not journaled,
+// their registration only records that one was made at this point of the workflow.
+type compensation struct {
+	Service string `json:"service"`
+	Method  string `json:"method"`
+	Input   any    `json:"input"`
+	IsFunc  bool   `json:"isFunc"`
+	fn      func() (any, error)
+}
+
+// saga keeps the compensations registered by a workflow. Every registration is a journaled step,
+// so a replay rebuilds the log from the journal the same way Memo results are returned.
+// Contexts of api tasks have no saga since nothing runs their compensations.
+type saga struct {
+	compensations []compensation
+}
+
+// Compensate registers a service method to be called if the workflow later returns an error.
+// Replays get back the method and input recorded when it was first registered.
+func (c Context) Compensate(service string, method string, input any) error {
+	return c.register(compensation{
+		Service: service,
+		Method:  method,
+		Input:   input,
+	})
+}
+
+// CompensateFunc registers a memoized function to be run if the workflow later returns an error.
+func (c Context) CompensateFunc(fn func() (any, error)) error {
+	return c.register(compensation{
+		IsFunc: true,
+		fn:     fn,
+	})
+}
+
+func (c Context) register(comp compensation) error {
+	if c.saga == nil {
+		return ErrTaskExecError.Wrap(errors.New("compensations can only be registered by workflows"))
+	}
+
+	res := c.Memo(func() (any, error) {
+		return comp, nil
+	})
+
+	var recorded compensation
+	err := res.Get(&recorded)
+	if err != nil {
+		return err
+	} else if recorded.IsFunc != comp.IsFunc {
+		return ErrTaskExecError.Wrap(fmt.Errorf("compensation %d was registered differently before", len(c.saga.compensations)))
+	}
+
+	recorded.fn = comp.fn
+	c.saga.compensations = append(c.saga.compensations, recorded)
+	return nil
+}
+
+// compensate runs the registered compensations in reverse order. Every compensation is a
+// journaled step, so a compensation that halts is not repeated when the task resumes.
+// A failed compensation does not stop the rest; the failures are returned joined together.
+func (c Context) compensate() error {
+	var errs []error
+	for i := len(c.saga.compensations) - 1; i >= 0; i-- {
+		comp := c.saga.compensations[i]
+
+		var res sdk.Response
+		var err error
+		if comp.IsFunc {
+			res = c.Memo(comp.fn)
+		} else {
+			res, err = c.Service(comp.Service).Get().RequestReply(sdk.TaskOptions{}, comp.Method, comp.Input)
+		}
+
+		if err == nil && res.IsError() {
+			err = res.Error()
+		}
+		if err != nil {
+			fmt.Printf("compensation %d failed %s\n", i, err.Error())
+			errs = append(errs, fmt.Errorf("compensation %d failed: %w", i, err))
+		}
+	}
+	c.saga.compensations = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,131 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudimpl/polycode-runtime/go/apicontext"
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSaga_CompensationFailuresAreReported(t *testing.T) {
+	undone := 0
+	client := newTestClient(t, &testService{
+		name: "saga",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Undo": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				return nil, errors.New("undo " + input.Name + " failed")
+			},
+		},
+		workflows: map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error){
+			"Book": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				err := ctx.CompensateFunc(func() (any, error) {
+					undone++
+					return nil, nil
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				err = ctx.Compensate("saga", "Undo", testInput{Name: "hotel"})
+				if err != nil {
+					return nil, err
+				}
+				return nil, errors.New("payment declined")
+			},
+		},
+	})
+
+	evt := runService(client, "saga", "Book", testInput{})
+	if !evt.IsError {
+		t.Fatal("expected the workflow to fail")
+	}
+	if !strings.Contains(evt.Error.CauseBy, "payment declined") || !strings.Contains(evt.Error.CauseBy, "undo hotel failed") {
+		t.Fatalf("expected the step and compensation errors, got %s", evt.Error.CauseBy)
+	}
+	if undone != 1 {
+		t.Fatalf("expected the remaining compensation to run once, ran %d times", undone)
+	}
+}
+
+func TestSaga_CompensationsSurviveHalts(t *testing.T) {
+	runs := 0
+	var undone []string
+	client := newTestClient(t, &testService{
+		name: "saga",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Undo": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				undone = append(undone, input.Name)
+				return nil, nil
+			},
+		},
+		workflows: map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error){
+			"Book": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				runs++
+
+				// replays register the input recorded by the first run, not the one they compute
+				err := ctx.Compensate("saga", "Undo", testInput{Name: fmt.Sprintf("booking-%d", runs)})
+				if err != nil {
+					return nil, err
+				}
+
+				err = ctx.Sleep(time.Minute)
+				if err != nil {
+					return nil, err
+				}
+				return nil, errors.New("payment declined")
+			},
+		},
+	})
+
+	runService(client, "saga", "Book", testInput{})
+	if len(undone) != 0 {
+		t.Fatalf("compensations ran before the workflow failed: %v", undone)
+	}
+
+	client.Advance(time.Minute)
+	client.RunPending(context.Background())
+	if runs != 2 || fmt.Sprint(undone) != "[booking-1]" {
+		t.Fatalf("expected the recorded compensation to run once after the replay, runs %d undone %v", runs, undone)
+	}
+}
+
+func TestSaga_ApiTasksCannotRegisterCompensations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/book", func(c *gin.Context) {
+		ctx, err := apicontext.FromContext(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = ctx.(sdk.WorkflowContext).Compensate("saga", "Undo", testInput{})
+		if err == nil {
+			c.JSON(http.StatusOK, gin.H{})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	})
+
+	client := newTestClient(t)
+	client.Attach(NewClientRuntime(client, WithHttpHandler(engine)))
+
+	evt := client.RunApi(context.Background(), ApiStartEvent{
+		Request: sdk.ApiRequest{
+			Method: "POST",
+			Path:   "/book",
+			Header: map[string]string{"Content-Type": "application/json"},
+			Body:   `{}`,
+		},
+	})
+	if evt.Response.StatusCode != http.StatusBadRequest || !strings.Contains(evt.Response.Body, "only be registered by workflows") {
+		t.Fatalf("expected the registration to be rejected, got %+v", evt.Response)
+	}
+}
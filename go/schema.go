@@ -0,0 +1,302 @@
+package runtime
+
+import (
+	"fmt"
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+	"github.com/invopop/jsonschema"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RequireRegistered makes writes to collections without a registered model fail, by default
+// they are written unchecked with a warning.
+func (m *ModelRegistry) RequireRegistered() {
+	m.strict = true
+}
+
+// writeModel returns the model a write to path is checked against, nil for an unregistered
+// collection unless the registry requires registered collections.
+func (m *ModelRegistry) writeModel(collection string, path string) (*registeredModel, error) {
+	model := m.models[collection]
+	if model != nil {
+		return model, nil
+	}
+
+	if m.strict {
+		return nil, sdk.ErrValidation.With(path, "collection is not registered")
+	}
+	fmt.Printf("writing data into unregistered collection %s\n", path)
+	return nil, nil
+}
+
+// Validate checks an item in its json form against the schema of the model registered for the collection.
+// It returns a sdk.ValidationError listing every violation, items of unregistered types are not checked.
+func (m *ModelRegistry) Validate(collection string, path string, item map[string]interface{}) error {
+	model, err := m.writeModel(collection, path)
+	if model == nil {
+		return err
+	}
+
+	v := &schemaValidator{root: model.schema}
+	v.validate(model.schema, "", item)
+	return v.err(path)
+}
+
+// ValidatePatch checks patch operations in their json form against the fields they change in the
+// model registered for the collection, so the patched document stays valid whatever else it holds.
+func (m *ModelRegistry) ValidatePatch(collection string, path string, ops []sdk.PatchOp) error {
+	model, err := m.writeModel(collection, path)
+	if model == nil {
+		return err
+	}
+
+	v := &schemaValidator{root: model.schema}
+	for _, op := range ops {
+		schema, parent, ok := v.fieldSchema(op.Path)
+		if !ok {
+			v.violate(op.Path, "field is not part of the model")
+			continue
+		}
+
+		switch op.Op {
+		case sdk.PatchSet, sdk.PatchSetIfAbsent, sdk.PatchIncrement, sdk.PatchAppend, sdk.PatchRemove:
+			// increments and list values are checked like the value they leave in the field
+			v.validate(schema, op.Path, op.Value)
+		case sdk.PatchUnset:
+			name := op.Path[strings.LastIndex(op.Path, ".")+1:]
+			if parent != nil && slices.Contains(parent.Required, name) {
+				v.violate(op.Path, "required field cannot be unset")
+			}
+		}
+	}
+	return v.err(path)
+}
+
+// CheckFields verifies that fields can be used in a filter and, when the collection is registered, that
+// each of them is a field of the model.
+func (m *ModelRegistry) CheckFields(collection string, path string, fields []string) error {
+	var violations []sdk.FieldViolation
+	model := m.models[collection]
+	for _, field := range fields {
+		if !validFieldName(field) {
+			violations = append(violations, sdk.FieldViolation{Field: field, Reason: "invalid field name"})
+		} else if model != nil && !(&schemaValidator{root: model.schema}).hasField(field) {
+			violations = append(violations, sdk.FieldViolation{Field: field, Reason: "field is not part of the model"})
+		}
+	}
+
+	if len(violations) > 0 {
+		return sdk.ValidationError{
+			Path:       path,
+			Violations: violations,
+		}
+	}
+	return nil
+}
+
+// validFieldName reports whether name can be written as a field in a filter expression
+func validFieldName(name string) bool {
+	tokens, err := tokenizeFilter(name)
+	if err != nil || len(tokens) != 1 || tokens[0].kind != tokenIdent || tokens[0].text != name {
+		return false
+	}
+
+	switch strings.ToLower(name) {
+	case "and", "or", "not", "in", "true", "false", "null":
+		return false
+	}
+	return !strings.HasSuffix(name, ".") && !strings.Contains(name, "..")
+}
+
+type schemaValidator struct {
+	root       *jsonschema.Schema
+	violations []sdk.FieldViolation
+}
+
+func (v *schemaValidator) violate(field string, format string, args ...any) {
+	if field == "" {
+		field = "$"
+	}
+	v.violations = append(v.violations, sdk.FieldViolation{
+		Field:  field,
+		Reason: fmt.Sprintf(format, args...),
+	})
+}
+
+// resolve follows local $defs references
+func (v *schemaValidator) resolve(schema *jsonschema.Schema) *jsonschema.Schema {
+	for schema != nil && schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/$defs/")
+		schema = v.root.Definitions[name]
+	}
+	return schema
+}
+
+func (v *schemaValidator) validate(schema *jsonschema.Schema, field string, value any) {
+	schema = v.resolve(schema)
+	// null is accepted for any field, pointers and empty interfaces are stored that way
+	if schema == nil || value == nil {
+		return
+	}
+
+	if len(schema.AnyOf) > 0 || len(schema.OneOf) > 0 {
+		v.validateAlternatives(append(schema.AnyOf, schema.OneOf...), field, value)
+	}
+
+	if schema.Type != "" && !matchesType(schema.Type, value) {
+		v.violate(field, "expected %s, got %s", schema.Type, jsonType(value))
+		return
+	}
+
+	if len(schema.Enum) > 0 {
+		var allowed []interface{}
+		if ConvertType(schema.Enum, &allowed) == nil && !containsValue(allowed, value) {
+			v.violate(field, "value %v is not one of %v", value, schema.Enum)
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(schema, field, value)
+	case []interface{}:
+		if schema.Items != nil {
+			for i, item := range value {
+				v.validate(schema.Items, fmt.Sprintf("%s[%d]", field, i), item)
+			}
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(schema *jsonschema.Schema, field string, value map[string]interface{}) {
+	for _, name := range schema.Required {
+		if _, ok := value[name]; !ok {
+			v.violate(joinField(field, name), "required field is missing")
+		}
+	}
+
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var property *jsonschema.Schema
+		if schema.Properties != nil {
+			property, _ = schema.Properties.Get(key)
+		}
+
+		if property != nil {
+			v.validate(property, joinField(field, key), value[key])
+		} else if schema.AdditionalProperties == jsonschema.FalseSchema {
+			v.violate(joinField(field, key), "field is not part of the model")
+		} else if schema.AdditionalProperties != nil {
+			v.validate(schema.AdditionalProperties, joinField(field, key), value[key])
+		}
+	}
+}
+
+func (v *schemaValidator) validateAlternatives(alternatives []*jsonschema.Schema, field string, value any) {
+	for _, alternative := range alternatives {
+		sub := &schemaValidator{root: v.root}
+		sub.validate(alternative, field, value)
+		if len(sub.violations) == 0 {
+			return
+		}
+	}
+	v.violate(field, "value does not match any of the allowed schemas")
+}
+
+func (v *schemaValidator) err(path string) error {
+	if len(v.violations) > 0 {
+		return sdk.ValidationError{
+			Path:       path,
+			Violations: v.violations,
+		}
+	}
+	return nil
+}
+
+// hasField checks that a dot separated path resolves in the schema, maps and untyped values accept any key
+func (v *schemaValidator) hasField(path string) bool {
+	_, _, ok := v.fieldSchema(path)
+	return ok
+}
+
+// fieldSchema resolves a dot separated path to the schema of the field and of the object holding it.
+// The schema is nil when the field accepts any value.
+func (v *schemaValidator) fieldSchema(path string) (*jsonschema.Schema, *jsonschema.Schema, bool) {
+	var parent *jsonschema.Schema
+	schema := v.root
+	for _, part := range strings.Split(path, ".") {
+		schema = v.resolve(schema)
+		if schema == nil || (schema.Type == "" && schema.Properties == nil) {
+			return nil, nil, true
+		}
+
+		var property *jsonschema.Schema
+		if schema.Properties != nil {
+			property, _ = schema.Properties.Get(part)
+		}
+
+		parent = schema
+		if property != nil {
+			schema = property
+		} else if schema.AdditionalProperties != nil && schema.AdditionalProperties != jsonschema.FalseSchema {
+			schema = schema.AdditionalProperties
+		} else {
+			return nil, nil, false
+		}
+	}
+	return schema, parent, true
+}
+
+func joinField(field string, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+func matchesType(schemaType string, value any) bool {
+	switch schemaType {
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return jsonType(value) == schemaType
+	}
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func containsValue(values []interface{}, value any) bool {
+	for _, item := range values {
+		if compareValues(item, value) == 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+func TestSchema_PatchesAreValidated(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Put": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				_, err := ctx.Db().Get().ServiceCollection("items").InsertOne(input.Name, &testItem{Name: input.Name})
+				return nil, err
+			},
+			"Patch": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				items := ctx.Db().Get().ServiceCollection("items")
+				doc, err := items.GetOne(input.Name)
+				if err != nil {
+					return nil, err
+				}
+
+				invalid := [][]sdk.PatchOp{
+					{sdk.Set("count", "many")},
+					{sdk.Unset("name")},
+					{sdk.Set("colour", "red")},
+					{sdk.Increment("count", 0.5)},
+				}
+				for _, ops := range invalid {
+					var validationErr sdk.ValidationError
+					if err = doc.Patch(ops); !errors.As(err, &validationErr) {
+						return nil, fmt.Errorf("expected %v to fail validation, got %v", ops, err)
+					}
+				}
+
+				var validationErr sdk.ValidationError
+				_, err = items.UpdateMany("", nil, map[string]interface{}{"count": "many"})
+				if !errors.As(err, &validationErr) {
+					return nil, fmt.Errorf("expected update many to fail validation, got %v", err)
+				}
+
+				err = doc.Patch([]sdk.PatchOp{sdk.Increment("count", 2)})
+				if err != nil {
+					return nil, err
+				}
+				_, err = items.UpdateMany("", nil, map[string]interface{}{"name": "renamed"})
+				return nil, err
+			},
+			"Other": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				_, err := ctx.Db().Get().ServiceCollection("other").InsertOne(input.Name, &testItem{Name: input.Name})
+				return nil, err
+			},
+		},
+	})
+
+	err := GetModelRegistry("store").Register("items", &testItem{})
+	if err != nil {
+		t.Fatalf("failed to register model: %s", err.Error())
+	}
+	startTestApp(t, client)
+
+	evt := runService(client, "store", "Put", testInput{Name: "a"})
+	if evt.IsError {
+		t.Fatalf("put failed: %s", evt.Error.Error())
+	}
+	evt = runService(client, "store", "Patch", testInput{Name: "a"})
+	if evt.IsError {
+		t.Fatalf("patch failed: %s", evt.Error.Error())
+	}
+
+	evt = runService(client, "store", "Other", testInput{Name: "a"})
+	if evt.IsError {
+		t.Fatalf("writing to an unregistered collection failed: %s", evt.Error.Error())
+	}
+
+	GetModelRegistry("store").RequireRegistered()
+	evt = runService(client, "store", "Other", testInput{Name: "b"})
+	if !evt.IsError {
+		t.Fatal("expected writing to an unregistered collection to fail once registration is required")
+	}
+}
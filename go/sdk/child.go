@@ -0,0 +1,20 @@
+package sdk
+
+type TaskStatus string
+
+const (
+	TaskStatusRunning   TaskStatus = "running"
+	TaskStatusCompleted TaskStatus = "completed"
+	TaskStatusFailed    TaskStatus = "failed"
+	TaskStatusCancelled TaskStatus = "cancelled"
+)
+
+// ChildWorkflow is a handle to a workflow started by another task. Attached children are
+// cancelled when their parent completes; Detach lets a child outlive its parent.
+type ChildWorkflow interface {
+	Future
+	TaskId() string
+	Status() (TaskStatus, error)
+	Cancel() error
+	Detach() error
+}
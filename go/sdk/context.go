@@ -2,6 +2,7 @@ package sdk
 
 import (
 	"context"
+	"time"
 )
 
 // unexported key type to avoid collisions in context values
@@ -33,6 +34,9 @@ func ApiContextFrom(ctx context.Context) (ApiContext, bool) {
 	return value.(ApiContext), true
 }
 
+// DefaultVersion is returned by GetVersion for instances that passed the change before it was introduced.
+const DefaultVersion = -1
+
 type BaseContext interface {
 	context.Context
 	Meta() TaskMeta
@@ -54,7 +58,17 @@ type WorkflowContext interface {
 	Agent(agent string) AgentBuilder
 	App(appName string) ServiceBuilder
 	Memo(getter func() (any, error)) Response
+	Compensate(service string, method string, input any) error
+	CompensateFunc(fn func() (any, error)) error
+	AwaitAll(futures ...Future) ([]Response, error)
+	AwaitAny(futures ...Future) (int, Response, error)
 	Signal(signalName string) Signal
+	Sleep(duration time.Duration) error
+	SleepUntil(until time.Time) error
+	Now() (time.Time, error)
+	Random(size int) ([]byte, error)
+	UUID() (string, error)
+	GetVersion(changeId string, minSupported int, maxSupported int) (int, error)
 	ClientChannel(channelName string) ClientChannel
 	Lock(key string) Lock
 }
@@ -2,6 +2,7 @@ package sdk
 
 import (
 	"context"
+	"iter"
 	"time"
 )
 
@@ -14,6 +15,18 @@ type WriteConfig struct {
 
 type WriteOption func(*WriteConfig)
 
+type SortOrder string
+
+const (
+	SortAsc  SortOrder = "asc"
+	SortDesc SortOrder = "desc"
+)
+
+type OrderBy struct {
+	Field string    `json:"field"`
+	Order SortOrder `json:"order"`
+}
+
 func WithExpireIn(expireIn time.Duration) WriteOption {
 	return func(cfg *WriteConfig) { cfg.ExpireIn = expireIn }
 }
@@ -26,6 +39,127 @@ func WithUpsert() WriteOption {
 	return func(cfg *WriteConfig) { cfg.Upsert = true }
 }
 
+// WithVersionEquals fails the write with ErrConflict unless the stored document is at the given version
+func WithVersionEquals(version int64) WriteOption {
+	return func(cfg *WriteConfig) { cfg.VersionEquals = version }
+}
+
+type AggregateOp string
+
+const (
+	AggregateCount AggregateOp = "count"
+	AggregateSum   AggregateOp = "sum"
+	AggregateMin   AggregateOp = "min"
+	AggregateMax   AggregateOp = "max"
+)
+
+type Aggregate struct {
+	Op    AggregateOp `json:"op"`
+	Field string      `json:"field"`
+}
+
+func Count() Aggregate {
+	return Aggregate{Op: AggregateCount}
+}
+
+func Sum(field string) Aggregate {
+	return Aggregate{Op: AggregateSum, Field: field}
+}
+
+func Min(field string) Aggregate {
+	return Aggregate{Op: AggregateMin, Field: field}
+}
+
+func Max(field string) Aggregate {
+	return Aggregate{Op: AggregateMax, Field: field}
+}
+
+// AggregateGroup holds the aggregate values of one group, in the order the aggregates were requested.
+// Key holds the group by fields and is empty when the query is not grouped.
+type AggregateGroup struct {
+	Key    map[string]interface{} `json:"key"`
+	Values []interface{}          `json:"values"`
+}
+
+type PatchOpType string
+
+const (
+	PatchSet         PatchOpType = "set"
+	PatchUnset       PatchOpType = "unset"
+	PatchIncrement   PatchOpType = "increment"
+	PatchAppend      PatchOpType = "append"
+	PatchRemove      PatchOpType = "remove"
+	PatchSetIfAbsent PatchOpType = "setIfAbsent"
+)
+
+// PatchOp changes a single field of a document, nested fields are addressed with dotted paths
+type PatchOp struct {
+	Op    PatchOpType `json:"op"`
+	Path  string      `json:"path"`
+	Value any         `json:"value"`
+}
+
+func Set(path string, value any) PatchOp {
+	return PatchOp{Op: PatchSet, Path: path, Value: value}
+}
+
+func Unset(path string) PatchOp {
+	return PatchOp{Op: PatchUnset, Path: path}
+}
+
+// Increment adds delta to a numeric field, a missing field counts as 0
+func Increment(path string, delta float64) PatchOp {
+	return PatchOp{Op: PatchIncrement, Path: path, Value: delta}
+}
+
+// Append adds values to the end of an array field, a missing field counts as empty
+func Append(path string, values ...any) PatchOp {
+	return PatchOp{Op: PatchAppend, Path: path, Value: values}
+}
+
+// Remove drops every element of an array field equal to one of values
+func Remove(path string, values ...any) PatchOp {
+	return PatchOp{Op: PatchRemove, Path: path, Value: values}
+}
+
+func SetIfAbsent(path string, value any) PatchOp {
+	return PatchOp{Op: PatchSetIfAbsent, Path: path, Value: value}
+}
+
+type InsertItem struct {
+	Id   string
+	Item interface{}
+	Opts []WriteOption
+}
+
+// BatchResult is the outcome of one document in a batch write
+type BatchResult struct {
+	Path    string `json:"path"`
+	IsError bool   `json:"isError"`
+	Error   Error  `json:"error"`
+}
+
+type ChangeType string
+
+const (
+	ChangeInsert ChangeType = "insert"
+	ChangeUpdate ChangeType = "update"
+	ChangeDelete ChangeType = "delete"
+)
+
+// ChangeEvent is the input a watching service method receives when a document of the
+// collection changes. OldData is nil for inserts and NewData is nil for deletes.
+type ChangeEvent struct {
+	Type       ChangeType             `json:"type"`
+	Scope      DataScope              `json:"scope"`
+	TenantId   string                 `json:"tenantId"`
+	Collection string                 `json:"collection"`
+	Path       string                 `json:"path"`
+	Version    int64                  `json:"version"`
+	OldData    map[string]interface{} `json:"oldData"`
+	NewData    map[string]interface{} `json:"newData"`
+}
+
 type ReadOnlyDataStoreBuilder interface {
 	WithTenantId(tenantId string) ReadOnlyDataStoreBuilder
 	Get() ReadOnlyDataStore
@@ -39,11 +173,21 @@ type DataStoreBuilder interface {
 type ReadOnlyDataStore interface {
 	ServiceCollection(name string) ReadOnlyCollection
 	AppCollection(name string) ReadOnlyCollection
+	// Resolve returns the referenced document, in the scope and tenant of the reference
+	Resolve(ref DocRef) (ReadOnlyDoc, error)
+	// ResolveMany fetches the referenced documents in one request, missing ones are nil
+	ResolveMany(refs []DocRef) ([]ReadOnlyDoc, error)
 }
 
 type DataStore interface {
 	ServiceCollection(name string) Collection
 	AppCollection(name string) Collection
+	// Resolve returns the referenced document, in the scope and tenant of the reference
+	Resolve(ref DocRef) (Doc, error)
+	// ResolveMany fetches the referenced documents in one request, missing ones are nil
+	ResolveMany(refs []DocRef) ([]Doc, error)
+	// Transaction commits the writes made through tx atomically, or none of them when fn returns an error
+	Transaction(fn func(tx DataStore) error) error
 }
 
 type ReadOnlyCollection interface {
@@ -57,47 +201,103 @@ type Collection interface {
 	GetOne(id string) (Doc, error)
 	Query() Query
 	InsertOne(id string, item interface{}, opts ...WriteOption) (Doc, error)
+	InsertMany(items []InsertItem, opts ...WriteOption) ([]BatchResult, error)
+	// UpdateMany sets the patch fields, dotted paths for nested ones, on every document matching the filter
+	UpdateMany(filter string, args []interface{}, patch map[string]interface{}, opts ...WriteOption) ([]BatchResult, error)
+	DeleteMany(filter string, args []interface{}, opts ...WriteOption) ([]BatchResult, error)
+	// UpdateWithRetry reads the document, calls mutate to change it in place and writes it back,
+	// starting over on ErrConflict up to maxAttempts times. It is not replay-safe, so workflows
+	// should call it inside a Memo step.
+	UpdateWithRetry(id string, mutate func(current map[string]interface{}) error, maxAttempts int, opts ...WriteOption) error
+	// Migrate rewrites the documents stored with an older schema version of the model in the current one
+	Migrate(ctx context.Context) (int, error)
 
 	Path() string
+	// TypeName is the type registered for the collection in the model registry, empty when unregistered
+	TypeName() string
 }
 
 type ReadOnlyDoc interface {
 	ChildCollection(name string) ReadOnlyCollection
 
 	Path() string
+	// Ref is a reference to the document that can be stored in other documents
+	Ref() DocRef
+	Version() int64
+	CreatedAt() time.Time
+	UpdatedAt() time.Time
+	// ExpiresAt is zero when the document has no ttl
+	ExpiresAt() time.Time
 	Unmarshal(item interface{}) error
 }
 
 type Doc interface {
 	ExpireIn(expireIn time.Duration, opts ...WriteOption) error
 	Update(item interface{}, opts ...WriteOption) error
+	// Patch applies the operations atomically on the stored document, whatever its version
+	// unless WithVersionEquals is given
+	Patch(ops []PatchOp, opts ...WriteOption) error
 	Delete(opts ...WriteOption) error
 	ChildCollection(name string) Collection
+	// Refresh reloads the document from the datastore
+	Refresh() error
 
 	Path() string
+	// Ref is a reference to the document that can be stored in other documents
+	Ref() DocRef
+	Version() int64
+	CreatedAt() time.Time
+	UpdatedAt() time.Time
+	// ExpiresAt is zero when the document has no ttl
+	ExpiresAt() time.Time
 	Unmarshal(item interface{}) error
 }
 
 type ReadOnlyQuery interface {
 	Filter(expr string, args ...interface{}) ReadOnlyQuery
+	// Where replaces the filter with a condition built with F, unknown fields fail the query
+	Where(condition Condition) ReadOnlyQuery
+	// OrderBy adds a sort key, keys apply in the order they are added
+	OrderBy(field string, order SortOrder) ReadOnlyQuery
+	// Select limits the returned documents to the given fields, they are decoded as stored without upgrades
+	Select(fields ...string) ReadOnlyQuery
 	Limit(limit int) ReadOnlyQuery
+	// GroupBy groups the results of Aggregate, Count, Sum, Min and Max ignore it
+	GroupBy(fields ...string) ReadOnlyQuery
 	GetOne(ctx context.Context) (ReadOnlyDoc, error)
 	GetAll(ctx context.Context) ([]ReadOnlyDoc, error)
+	// Page returns one page of results and the token of the next page, empty on the last page.
+	Page(ctx context.Context, token string) ([]ReadOnlyDoc, string, error)
+	Iter(ctx context.Context) iter.Seq2[ReadOnlyDoc, error]
 
-	// Optional future support
-	// Iter() PagingIter
-	// AllWithNextToken(ctx context.Context, ret interface{}) (PageToken, error)
-	// Count(ctx context.Context) (int, error)
+	Count(ctx context.Context) (int64, error)
+	Sum(ctx context.Context, field string) (float64, error)
+	Min(ctx context.Context, field string) (any, error)
+	Max(ctx context.Context, field string) (any, error)
+	Aggregate(ctx context.Context, aggregates ...Aggregate) ([]AggregateGroup, error)
 }
 
 type Query interface {
 	Filter(expr string, args ...interface{}) Query
+	// Where replaces the filter with a condition built with F, unknown fields fail the query
+	Where(condition Condition) Query
+	// OrderBy adds a sort key, keys apply in the order they are added
+	OrderBy(field string, order SortOrder) Query
+	// Select limits the returned documents to the given fields. Such documents are decoded as
+	// stored without upgrades and cannot be updated or patched until they are refreshed.
+	Select(fields ...string) Query
 	Limit(limit int) Query
+	// GroupBy groups the results of Aggregate, Count, Sum, Min and Max ignore it
+	GroupBy(fields ...string) Query
 	GetOne(ctx context.Context) (Doc, error)
 	GetAll(ctx context.Context) ([]Doc, error)
+	// Page returns one page of results and the token of the next page, empty on the last page.
+	Page(ctx context.Context, token string) ([]Doc, string, error)
+	Iter(ctx context.Context) iter.Seq2[Doc, error]
 
-	// Optional future support
-	// Iter() PagingIter
-	// AllWithNextToken(ctx context.Context, ret interface{}) (PageToken, error)
-	// Count(ctx context.Context) (int, error)
+	Count(ctx context.Context) (int64, error)
+	Sum(ctx context.Context, field string) (float64, error)
+	Min(ctx context.Context, field string) (any, error)
+	Max(ctx context.Context, field string) (any, error)
+	Aggregate(ctx context.Context, aggregates ...Aggregate) ([]AggregateGroup, error)
 }
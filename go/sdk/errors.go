@@ -13,6 +13,12 @@ var ErrNotFound = &errNotFound
 var ErrAlreadyExist = DefineError("sdk.sdk", 1, "already exist")
 var ErrConflict = DefineError("sdk.sdk", 2, "conflict")
 var ErrContextNotFound = DefineError("sdk.sdk", 3, "context not found")
+var ErrSignalTimeout = DefineError("sdk.sdk", 4, "signal %s timed out")
+var ErrUnsupportedVersion = DefineError("sdk.sdk", 5, "change %s recorded version %d, supported range is [%d, %d]")
+var ErrTaskCancelled = DefineError("sdk.sdk", 6, "task %s cancelled")
+var ErrPartialDocument = DefineError("sdk.sdk", 7, "document %s holds only the selected fields")
+var ErrValidation = DefineError("sdk.sdk", 8, "validation failed for %s: %s")
+var ErrStaleSchema = DefineError("sdk.sdk", 9, "document %s is stored with schema version %d, older than %d")
 
 type Stacktrace struct {
 	Stacktrace   string `json:"stacktrace"`
@@ -122,6 +128,26 @@ func (t Error) ToJson() string {
 	}
 }
 
+// FieldViolation is a single schema rule a document broke, Field is the dot separated path of the value
+type FieldViolation struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError is returned when a document does not match the schema of its collection
+type ValidationError struct {
+	Path       string           `json:"path"`
+	Violations []FieldViolation `json:"violations"`
+}
+
+func (e ValidationError) Error() string {
+	var reasons []string
+	for _, violation := range e.Violations {
+		reasons = append(reasons, violation.Field+": "+violation.Reason)
+	}
+	return ErrValidation.With(e.Path, strings.Join(reasons, ", ")).Error()
+}
+
 func DefineError(module string, errorNo int, format string) Error {
 	return Error{
 		Module:   module,
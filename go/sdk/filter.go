@@ -0,0 +1,121 @@
+package sdk
+
+// Condition is a filter built with F. It renders to the expression and args Filter accepts and
+// keeps the fields it refers to so they can be checked against the model. The zero Condition
+// adds no constraint, it is left out of And and Or so conditions can be built up from it.
+type Condition struct {
+	expr   string
+	args   []interface{}
+	fields []string
+}
+
+func (c Condition) Expr() string {
+	return c.expr
+}
+
+func (c Condition) Args() []interface{} {
+	return c.args
+}
+
+func (c Condition) Fields() []string {
+	return c.fields
+}
+
+func (c Condition) And(other Condition) Condition {
+	return c.join("AND", other)
+}
+
+func (c Condition) Or(other Condition) Condition {
+	return c.join("OR", other)
+}
+
+func (c Condition) join(op string, other Condition) Condition {
+	if c.expr == "" {
+		return other
+	} else if other.expr == "" {
+		return c
+	}
+
+	return Condition{
+		expr:   "(" + c.expr + ") " + op + " (" + other.expr + ")",
+		args:   append(append([]interface{}{}, c.args...), other.args...),
+		fields: append(append([]string{}, c.fields...), other.fields...),
+	}
+}
+
+// Not negates c, the zero Condition stays empty
+func Not(c Condition) Condition {
+	if c.expr == "" {
+		return c
+	}
+
+	return Condition{
+		expr:   "NOT (" + c.expr + ")",
+		args:   c.args,
+		fields: c.fields,
+	}
+}
+
+// Field names a document field in a Condition, nested fields use dotted paths
+type Field struct {
+	name string
+}
+
+func F(name string) Field {
+	return Field{name: name}
+}
+
+func (f Field) compare(op string, value any) Condition {
+	return Condition{
+		expr:   f.name + " " + op + " ?",
+		args:   []interface{}{value},
+		fields: []string{f.name},
+	}
+}
+
+func (f Field) Eq(value any) Condition {
+	return f.compare("=", value)
+}
+
+func (f Field) Ne(value any) Condition {
+	return f.compare("!=", value)
+}
+
+func (f Field) Lt(value any) Condition {
+	return f.compare("<", value)
+}
+
+func (f Field) Lte(value any) Condition {
+	return f.compare("<=", value)
+}
+
+func (f Field) Gt(value any) Condition {
+	return f.compare(">", value)
+}
+
+func (f Field) Gte(value any) Condition {
+	return f.compare(">=", value)
+}
+
+// In matches documents whose field equals one of values, no values matches nothing
+func (f Field) In(values ...any) Condition {
+	return Condition{
+		expr:   f.name + " IN ?",
+		args:   []interface{}{append([]any{}, values...)},
+		fields: []string{f.name},
+	}
+}
+
+func (f Field) IsNull() Condition {
+	return Condition{
+		expr:   f.name + " = null",
+		fields: []string{f.name},
+	}
+}
+
+func (f Field) NotNull() Condition {
+	return Condition{
+		expr:   f.name + " != null",
+		fields: []string{f.name},
+	}
+}
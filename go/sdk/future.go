@@ -0,0 +1,6 @@
+package sdk
+
+type Future interface {
+	CallId() string
+	Await() (Response, error)
+}
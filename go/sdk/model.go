@@ -127,7 +127,17 @@ type MethodDescription struct {
 }
 
 type CollectionDescription struct {
-	Name     string      `json:"name"`
-	TypeName string      `json:"typeName"`
-	Schema   interface{} `json:"schema"`
+	Name          string             `json:"name"`
+	TypeName      string             `json:"typeName"`
+	Schema        interface{}        `json:"schema"`
+	SchemaVersion int                `json:"schemaVersion"`
+	Indexes       []IndexDescription `json:"indexes"`
+	Watchers      []string           `json:"watchers"`
+}
+
+// IndexDescription is a secondary index on a collection, a composite index lists its fields in key order
+type IndexDescription struct {
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+	Unique bool     `json:"unique"`
 }
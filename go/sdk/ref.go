@@ -0,0 +1,73 @@
+package sdk
+
+import (
+	"strings"
+)
+
+// DocRef points to a document by scope, tenant and path. It can be stored as a field of another
+// document and resolved back with Resolve on a datastore, whichever tenant the datastore is for.
+// Service scoped references resolve in the service that reads them.
+type DocRef struct {
+	Scope    DataScope `json:"scope"`
+	TenantId string    `json:"tenantId"`
+	Path     string    `json:"path"`
+}
+
+// Ref builds a reference from the collection names and document ids along the path,
+// e.g. Ref(DataScopeApp, tenantId, "orders", orderId, "items", itemId)
+func Ref(scope DataScope, tenantId string, segments ...string) DocRef {
+	return DocRef{
+		Scope:    scope,
+		TenantId: tenantId,
+		Path:     strings.Join(segments, "/"),
+	}
+}
+
+func (r DocRef) IsZero() bool {
+	return r == DocRef{}
+}
+
+// Collection is the path of the collection holding the document
+func (r DocRef) Collection() string {
+	idx := strings.LastIndex(r.Path, "/")
+	if idx < 0 {
+		return ""
+	}
+	return r.Path[:idx]
+}
+
+func (r DocRef) Id() string {
+	return r.Path[strings.LastIndex(r.Path, "/")+1:]
+}
+
+// Validate checks that the reference names a known scope and a document path made of
+// collection and id pairs. It returns a ValidationError listing what is wrong.
+func (r DocRef) Validate() error {
+	var violations []FieldViolation
+	if r.Scope != DataScopeService && r.Scope != DataScopeApp {
+		violations = append(violations, FieldViolation{Field: "scope", Reason: "unknown scope " + string(r.Scope)})
+	}
+
+	segments := strings.Split(r.Path, "/")
+	if len(segments)%2 != 0 {
+		violations = append(violations, FieldViolation{Field: "path", Reason: "not a document path"})
+	}
+	for _, segment := range segments {
+		if segment == "" {
+			violations = append(violations, FieldViolation{Field: "path", Reason: "empty path segment"})
+			break
+		}
+	}
+
+	if len(violations) > 0 {
+		return ValidationError{
+			Path:       r.String(),
+			Violations: violations,
+		}
+	}
+	return nil
+}
+
+func (r DocRef) String() string {
+	return string(r.Scope) + ":" + r.TenantId + ":" + r.Path
+}
@@ -3,6 +3,8 @@ package sdk
 type Service interface {
 	RequestReply(options TaskOptions, method string, input any) (Response, error)
 	Send(options TaskOptions, method string, input any) error
+	Async(options TaskOptions, method string, input any) (Future, error)
+	StartChild(options TaskOptions, method string, input any) (ChildWorkflow, error)
 }
 
 type ServiceBuilder interface {
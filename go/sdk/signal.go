@@ -1,7 +1,30 @@
 package sdk
 
+import "time"
+
 type Signal interface {
 	Await() (Response, error)
+	AwaitWithTimeout(timeout time.Duration) (Response, error)
 	EmitValue(taskId string, data any) error
 	EmitError(taskId string, err Error) error
 }
+
+// AwaitSignal waits for the signal and decodes its payload into T.
+// A zero timeout waits until the signal is emitted.
+func AwaitSignal[T any](signal Signal, timeout time.Duration) (T, error) {
+	var ret T
+
+	var res Response
+	var err error
+	if timeout > 0 {
+		res, err = signal.AwaitWithTimeout(timeout)
+	} else {
+		res, err = signal.Await()
+	}
+	if err != nil {
+		return ret, err
+	}
+
+	err = res.Get(&ret)
+	return ret, err
+}
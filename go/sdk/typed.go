@@ -0,0 +1,165 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"reflect"
+)
+
+// TypedCollection wraps a Collection whose documents are of type T
+type TypedCollection[T any] struct {
+	collection Collection
+}
+
+// NewTypedCollection binds T to a collection, failing when the model registered for it is of another type.
+func NewTypedCollection[T any](collection Collection) (TypedCollection[T], error) {
+	typeName := reflect.TypeFor[T]().Name()
+	if collection.TypeName() != "" && collection.TypeName() != typeName {
+		return TypedCollection[T]{}, fmt.Errorf("type name mismatch: collection %s holds %s, got %s", collection.Path(), collection.TypeName(), typeName)
+	}
+
+	return TypedCollection[T]{
+		collection: collection,
+	}, nil
+}
+
+func (c TypedCollection[T]) Collection() Collection {
+	return c.collection
+}
+
+// GetOne returns the document with its version
+func (c TypedCollection[T]) GetOne(id string) (T, int64, error) {
+	var ret T
+	doc, err := c.collection.GetOne(id)
+	if err != nil {
+		return ret, 0, err
+	}
+
+	err = doc.Unmarshal(&ret)
+	return ret, doc.Version(), err
+}
+
+func (c TypedCollection[T]) InsertOne(id string, item T, opts ...WriteOption) (Doc, error) {
+	return c.collection.InsertOne(id, &item, opts...)
+}
+
+// UpdateWithRetry applies mutate to the current document and writes it, re-reading and applying it
+// again when a concurrent write causes ErrConflict. It returns the document as written. Like
+// Collection.UpdateWithRetry it is not replay-safe.
+func (c TypedCollection[T]) UpdateWithRetry(id string, mutate func(current *T) error, maxAttempts int, opts ...WriteOption) (T, error) {
+	var current T
+	err := c.collection.UpdateWithRetry(id, func(doc map[string]interface{}) error {
+		current = *new(T)
+		err := convert(doc, &current)
+		if err != nil {
+			return err
+		}
+
+		err = mutate(&current)
+		if err != nil {
+			return err
+		}
+
+		clear(doc)
+		return convert(current, &doc)
+	}, maxAttempts, opts...)
+	return current, err
+}
+
+// convert copies in into out through their JSON encoding
+func convert(in any, out any) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func (c TypedCollection[T]) Query() TypedQuery[T] {
+	return TypedQuery[T]{
+		query: c.collection.Query(),
+	}
+}
+
+// TypedQuery is a Query decoding its results into T
+type TypedQuery[T any] struct {
+	query Query
+}
+
+func (q TypedQuery[T]) Filter(expr string, args ...interface{}) TypedQuery[T] {
+	q.query = q.query.Filter(expr, args...)
+	return q
+}
+
+func (q TypedQuery[T]) Where(condition Condition) TypedQuery[T] {
+	q.query = q.query.Where(condition)
+	return q
+}
+
+func (q TypedQuery[T]) OrderBy(field string, order SortOrder) TypedQuery[T] {
+	q.query = q.query.OrderBy(field, order)
+	return q
+}
+
+func (q TypedQuery[T]) Limit(limit int) TypedQuery[T] {
+	q.query = q.query.Limit(limit)
+	return q
+}
+
+func (q TypedQuery[T]) GetOne(ctx context.Context) (T, error) {
+	var ret T
+	doc, err := q.query.GetOne(ctx)
+	if err != nil {
+		return ret, err
+	}
+
+	err = doc.Unmarshal(&ret)
+	return ret, err
+}
+
+func (q TypedQuery[T]) GetAll(ctx context.Context) ([]T, error) {
+	ret := make([]T, 0)
+	for item, err := range q.Iter(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, item)
+	}
+	return ret, nil
+}
+
+func (q TypedQuery[T]) Page(ctx context.Context, token string) ([]T, string, error) {
+	docs, next, err := q.query.Page(ctx, token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ret := make([]T, len(docs))
+	for i, doc := range docs {
+		if err = doc.Unmarshal(&ret[i]); err != nil {
+			return nil, "", err
+		}
+	}
+	return ret, next, nil
+}
+
+func (q TypedQuery[T]) Iter(ctx context.Context) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for doc, err := range q.query.Iter(ctx) {
+			var item T
+			if err == nil {
+				err = doc.Unmarshal(&item)
+			}
+
+			if !yield(item, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (q TypedQuery[T]) Count(ctx context.Context) (int64, error) {
+	return q.query.Count(ctx)
+}
@@ -71,6 +71,54 @@ func (r *Service) Send(options sdk.TaskOptions, method string, input any) error
 	return r.serviceClient.SendService(r.sessionId, req)
 }
 
+func (r *Service) Async(options sdk.TaskOptions, method string, input any) (sdk.Future, error) {
+	req := ExecServiceRequest{
+		EnvId:   r.envId,
+		Service: r.service,
+		Method:  method,
+		Options: options,
+		Input:   input,
+	}
+
+	output, err := r.serviceClient.CallServiceAsync(r.sessionId, req)
+	if err != nil {
+		fmt.Printf("client: exec service async error: %v\n", err)
+		return nil, err
+	}
+
+	return &Future{
+		sessionId:     r.sessionId,
+		callId:        output.CallId,
+		serviceClient: r.serviceClient,
+	}, nil
+}
+
+// StartChild starts a workflow method as a child of the current task and returns a handle to it.
+func (r *Service) StartChild(options sdk.TaskOptions, method string, input any) (sdk.ChildWorkflow, error) {
+	req := ExecServiceRequest{
+		EnvId:   r.envId,
+		Service: r.service,
+		Method:  method,
+		Options: options,
+		Input:   input,
+	}
+
+	output, err := r.serviceClient.StartChild(r.sessionId, req)
+	if err != nil {
+		fmt.Printf("client: start child error: %v\n", err)
+		return nil, err
+	}
+
+	return &ChildWorkflow{
+		Future: Future{
+			sessionId:     r.sessionId,
+			callId:        output.CallId,
+			serviceClient: r.serviceClient,
+		},
+		taskId: output.TaskId,
+	}, nil
+}
+
 type AppServiceBuilder struct {
 	ctx           context.Context
 	sessionId     string
@@ -135,3 +183,30 @@ func (r *AppService) Send(options sdk.TaskOptions, method string, input any) err
 
 	return r.serviceClient.SendApp(r.sessionId, req)
 }
+
+func (r *AppService) Async(options sdk.TaskOptions, method string, input any) (sdk.Future, error) {
+	req := ExecAppRequest{
+		EnvId:   r.envId,
+		AppName: r.appName,
+		Method:  method,
+		Options: options,
+		Input:   input,
+	}
+
+	output, err := r.serviceClient.CallAppAsync(r.sessionId, req)
+	if err != nil {
+		fmt.Printf("client: exec app async error: %v\n", err)
+		return nil, err
+	}
+
+	return &Future{
+		sessionId:     r.sessionId,
+		callId:        output.CallId,
+		serviceClient: r.serviceClient,
+	}, nil
+}
+
+// StartChild is not supported across apps, the child lifecycle is tracked by the sidecar of a single app.
+func (r *AppService) StartChild(options sdk.TaskOptions, method string, input any) (sdk.ChildWorkflow, error) {
+	return nil, ErrTaskExecError.Wrap(fmt.Errorf("child workflows are not supported for app %s", r.appName))
+}
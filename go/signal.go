@@ -2,6 +2,7 @@ package runtime
 
 import (
 	"github.com/cloudimpl/polycode-runtime/go/sdk"
+	"time"
 )
 
 type Signal struct {
@@ -10,23 +11,31 @@ type Signal struct {
 	name      string
 }
 
-func (s *Signal) Await() sdk.Response {
+func (s *Signal) Await() (sdk.Response, error) {
+	return s.AwaitWithTimeout(0)
+}
+
+func (s *Signal) AwaitWithTimeout(timeout time.Duration) (sdk.Response, error) {
 	output, err := s.client.WaitForSignal(s.sessionId, SignalWaitRequest{
 		SignalName: s.name,
+		Timeout:    timeout.Milliseconds(),
 	})
 	if err != nil {
-		return &Response{
-			output:  nil,
-			isError: true,
-			error:   ErrInternal.Wrap(err),
-		}
+		return nil, err
+	}
+
+	if output.IsAsync {
+		// signal not emitted yet, task resumes once it arrives
+		panic(HaltExecution)
+	} else if output.IsTimeout {
+		return nil, sdk.ErrSignalTimeout.With(s.name)
 	}
 
 	return &Response{
 		output:  output.Output,
 		isError: output.IsError,
 		error:   output.Error,
-	}
+	}, nil
 }
 
 func (s *Signal) EmitValue(taskId string, data any) error {
@@ -48,3 +57,5 @@ func (s *Signal) EmitError(taskId string, err sdk.Error) error {
 		Error:      err,
 	})
 }
+
+var _ sdk.Signal = (*Signal)(nil)
@@ -0,0 +1,60 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+func TestSignal_ResumesWaitingWorkflow(t *testing.T) {
+	taskIds := make(map[string]string)
+	results := make(map[string]int)
+	client := newTestClient(t, &testService{
+		name: "approvals",
+		workflows: map[string]func(ctx sdk.WorkflowContext, input *testInput) (any, error){
+			"Wait": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				taskIds[input.Name] = ctx.Meta().TaskId
+				approval, err := sdk.AwaitSignal[testInput](ctx.Signal("approve"), 0)
+				if err != nil {
+					return nil, err
+				}
+
+				results[input.Name] = approval.Count
+				return approval.Count, nil
+			},
+			"Approve": func(ctx sdk.WorkflowContext, input *testInput) (any, error) {
+				return nil, ctx.Signal("approve").EmitValue(taskIds[input.Name], testInput{Count: input.Count})
+			},
+		},
+	})
+
+	runService(client, "approvals", "Wait", testInput{Name: "a"})
+	runService(client, "approvals", "Wait", testInput{Name: "b"})
+	if len(results) != 0 {
+		t.Fatalf("workflows completed before they were signalled %v", results)
+	}
+
+	// a signal from outside any task, as the platform delivers it
+	err := client.EmitSignal("", SignalEmitRequest{
+		TaskId:     taskIds["a"],
+		SignalName: "approve",
+		Output:     testInput{Count: 3},
+	})
+	if err != nil {
+		t.Fatalf("failed to emit signal: %s", err.Error())
+	}
+	client.RunPending(context.Background())
+	if results["a"] != 3 || len(results) != 1 {
+		t.Fatalf("expected only a to resume with 3, got %v", results)
+	}
+
+	// a signal emitted by another workflow
+	evt := runService(client, "approvals", "Approve", testInput{Name: "b", Count: 5})
+	if evt.IsError {
+		t.Fatalf("approve failed: %s", evt.Error.Error())
+	}
+	if results["b"] != 5 {
+		t.Fatalf("expected b to resume with 5, got %v", results)
+	}
+}
@@ -0,0 +1,406 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// txClient buffers the datastore writes of a transaction so they are committed in a single
+// request. Reads go to the sidecar and see the documents already written in the transaction,
+// and the versions read are checked again at commit.
+type txClient struct {
+	ServiceClient
+
+	reads   []TransactionRead
+	seen    map[string]bool
+	writes  []TransactionWrite
+	written map[string]GetDataResponse
+	// versions holds the version each document will have once the writes are committed,
+	// known for documents read before they were written, 0 for ones that will not exist
+	versions map[string]int64
+}
+
+func newTxClient(client ServiceClient) *txClient {
+	return &txClient{
+		ServiceClient: client,
+		seen:          make(map[string]bool),
+		written:       make(map[string]GetDataResponse),
+		versions:      make(map[string]int64),
+	}
+}
+
+func (t *txClient) read(scope sdk.DataScope, tenantId string, path string, version int64) {
+	key := memoryKey(scope, tenantId, path)
+	if t.seen[key] {
+		return
+	}
+
+	t.seen[key] = true
+	if _, ok := t.written[key]; !ok {
+		t.versions[key] = version
+	}
+	t.reads = append(t.reads, TransactionRead{
+		Scope:    scope,
+		TenantId: tenantId,
+		Path:     path,
+		Version:  version,
+	})
+}
+
+func (t *txClient) GetData(sessionId string, req GetDataRequest) (GetDataResponse, error) {
+	if data, ok := t.written[memoryKey(req.Scope, req.TenantId, req.Path)]; ok {
+		return data, nil
+	}
+
+	data, err := t.ServiceClient.GetData(sessionId, req)
+	if err != nil {
+		return data, err
+	}
+
+	version := int64(0)
+	if data.Exist {
+		version = data.Version
+	}
+	t.read(req.Scope, req.TenantId, req.Path, version)
+	return data, nil
+}
+
+// GetMany reads each document through GetData, so writes of the transaction are seen and the reads checked at commit
+func (t *txClient) GetMany(sessionId string, req GetManyRequest) (GetManyResponse, error) {
+	res := GetManyResponse{
+		Items: make([]GetDataResponse, 0, len(req.Items)),
+	}
+	for _, item := range req.Items {
+		data, err := t.GetData(sessionId, item)
+		if err != nil {
+			return GetManyResponse{}, err
+		}
+		res.Items = append(res.Items, data)
+	}
+	return res, nil
+}
+
+// QueryData sees the writes of the transaction. Queries of a collection written in the transaction
+// read all the committed matches, merge them with the written documents and page over the result.
+func (t *txClient) QueryData(sessionId string, req QueryDataRequest) (QueryDataResponse, error) {
+	written := t.writtenIn(req.Scope, req.TenantId, req.CollectionPath)
+	if len(written) == 0 {
+		data, err := t.ServiceClient.QueryData(sessionId, req)
+		if err != nil {
+			return data, err
+		}
+
+		for _, item := range data.Data {
+			t.read(req.Scope, req.TenantId, item.Path, item.Version)
+		}
+		return data, nil
+	}
+
+	filter, err := parseMemoryFilter(req.Filter, req.Args)
+	if err != nil {
+		return QueryDataResponse{}, ErrBadRequest.Wrap(err)
+	}
+
+	offset := 0
+	if req.OffsetToken != "" {
+		offset, err = strconv.Atoi(req.OffsetToken)
+		if err != nil || offset < 0 {
+			return QueryDataResponse{}, ErrBadRequest.Wrap(fmt.Errorf("invalid offset token %s", req.OffsetToken))
+		}
+	}
+
+	// the written documents are matched on the client, so they are read in full
+	committed := req
+	committed.Select = nil
+	committed.OffsetToken = ""
+	committed.Limit = 0
+
+	var items []GetDataResponse
+	err = queryAll(context.Background(), t.ServiceClient, sessionId, committed, func(item GetDataResponse) bool {
+		t.read(req.Scope, req.TenantId, item.Path, item.Version)
+		if _, ok := written[item.Path]; !ok {
+			items = append(items, item)
+		}
+		return true
+	})
+	if err != nil {
+		return QueryDataResponse{}, err
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(written)) {
+		item := written[path]
+		if !item.Exist {
+			continue
+		}
+
+		ok, err := filter.match(item.Data)
+		if err != nil {
+			return QueryDataResponse{}, ErrBadRequest.Wrap(err)
+		} else if !ok {
+			continue
+		}
+
+		// callers get their own copy of the buffered write
+		item.Data, err = copyData(item.Data)
+		if err != nil {
+			return QueryDataResponse{}, err
+		}
+		items = append(items, item)
+	}
+
+	err = sortByFields(items, req.OrderBy, func(item GetDataResponse) (string, map[string]interface{}) {
+		return item.Path, item.Data
+	})
+	if err != nil {
+		return QueryDataResponse{}, err
+	}
+
+	end := len(items)
+	if req.Limit > 0 && offset+req.Limit < end {
+		end = offset + req.Limit
+	}
+
+	res := QueryDataResponse{
+		Data: make([]GetDataResponse, 0),
+	}
+	for i := offset; i < end; i++ {
+		item := items[i]
+		if len(req.Select) > 0 {
+			item.Data = projectData(item.Data, req.Select)
+		}
+		res.Data = append(res.Data, item)
+	}
+
+	if end < len(items) {
+		res.NextToken = strconv.Itoa(end)
+	}
+	return res, nil
+}
+
+// writtenIn returns the documents of a collection written in the transaction, by path
+func (t *txClient) writtenIn(scope sdk.DataScope, tenantId string, collectionPath string) map[string]GetDataResponse {
+	written := make(map[string]GetDataResponse)
+	for key, data := range t.written {
+		if fileDir(data.Path) == collectionPath && key == memoryKey(scope, tenantId, data.Path) {
+			written[data.Path] = data
+		}
+	}
+	return written
+}
+
+// nextVersion moves the pending version of a document past one more write. It returns 0 when
+// the document was written without being read first, as its version is only known once committed.
+func (t *txClient) nextVersion(key string) int64 {
+	version, ok := t.versions[key]
+	if !ok {
+		return 0
+	}
+
+	t.versions[key] = version + 1
+	return version + 1
+}
+
+// InsertData buffers the insert, the timestamps of the document are only known once committed
+func (t *txClient) InsertData(sessionId string, req InsertDataRequest) (WriteDataResponse, error) {
+	key := memoryKey(req.Scope, req.TenantId, req.Path)
+	if data, ok := t.written[key]; ok && data.Exist && !req.Cfg.Upsert {
+		return WriteDataResponse{}, sdk.ErrAlreadyExist
+	}
+
+	t.writes = append(t.writes, TransactionWrite{Insert: &req})
+	t.written[key] = GetDataResponse{
+		Path:          req.Path,
+		Exist:         true,
+		Version:       t.nextVersion(key),
+		SchemaVersion: req.SchemaVersion,
+		Data:          req.Item,
+	}
+	return WriteDataResponse{Version: t.written[key].Version}, nil
+}
+
+func (t *txClient) UpdateData(sessionId string, req UpdateDataRequest) (WriteDataResponse, error) {
+	key := memoryKey(req.Scope, req.TenantId, req.Path)
+	if data, ok := t.written[key]; ok && !data.Exist {
+		return WriteDataResponse{}, sdk.ErrNotFound
+	}
+
+	t.writes = append(t.writes, TransactionWrite{Update: &req})
+	t.written[key] = GetDataResponse{
+		Path:          req.Path,
+		Exist:         true,
+		Version:       t.nextVersion(key),
+		SchemaVersion: req.SchemaVersion,
+		Data:          req.Item,
+	}
+	return WriteDataResponse{Version: t.written[key].Version}, nil
+}
+
+func (t *txClient) DeleteData(sessionId string, req DeleteDataRequest) error {
+	key := memoryKey(req.Scope, req.TenantId, req.Path)
+	if data, ok := t.written[key]; ok && !data.Exist {
+		return sdk.ErrNotFound
+	}
+
+	t.writes = append(t.writes, TransactionWrite{Delete: &req})
+	t.written[key] = GetDataResponse{
+		Path:  req.Path,
+		Exist: false,
+	}
+	t.versions[key] = 0
+	return nil
+}
+
+func (t *txClient) UpdateTTL(sessionId string, req UpdateTTLRequest) (WriteDataResponse, error) {
+	key := memoryKey(req.Scope, req.TenantId, req.Path)
+	t.writes = append(t.writes, TransactionWrite{UpdateTTL: &req})
+	version := t.nextVersion(key)
+	if data, ok := t.written[key]; ok {
+		data.Version = version
+		t.written[key] = data
+	}
+	return WriteDataResponse{Version: version}, nil
+}
+
+// PatchData applies the patch on the client to the document as read in the transaction
+func (t *txClient) PatchData(sessionId string, req PatchDataRequest) (GetDataResponse, error) {
+	data, err := t.GetData(sessionId, GetDataRequest{
+		Scope:    req.Scope,
+		TenantId: req.TenantId,
+		Path:     req.Path,
+	})
+	if err != nil {
+		return GetDataResponse{}, err
+	} else if !data.Exist {
+		return GetDataResponse{}, sdk.ErrNotFound
+	} else if req.SchemaVersion > max(data.SchemaVersion, 1) {
+		return GetDataResponse{}, sdk.ErrStaleSchema.With(req.Path, data.SchemaVersion, req.SchemaVersion)
+	}
+
+	item, err := copyData(data.Data)
+	if err != nil {
+		return GetDataResponse{}, err
+	}
+
+	err = applyPatch(item, req.Ops)
+	if err != nil {
+		return GetDataResponse{}, err
+	}
+
+	res, err := t.UpdateData(sessionId, UpdateDataRequest{
+		Scope:         req.Scope,
+		TenantId:      req.TenantId,
+		Path:          req.Path,
+		Item:          item,
+		SchemaVersion: data.SchemaVersion,
+		Cfg:           req.Cfg,
+	})
+	return GetDataResponse{
+		Path:          req.Path,
+		Exist:         true,
+		Version:       res.Version,
+		SchemaVersion: data.SchemaVersion,
+		Data:          item,
+		CreatedAt:     data.CreatedAt,
+		UpdatedAt:     data.UpdatedAt,
+		ExpiresAt:     data.ExpiresAt,
+	}, err
+}
+
+// InsertMany buffers each insert, an item that cannot be written fails on its own like outside a transaction
+func (t *txClient) InsertMany(sessionId string, req InsertManyRequest) (BatchWriteResponse, error) {
+	res := BatchWriteResponse{
+		Results: make([]sdk.BatchResult, 0, len(req.Items)),
+	}
+	for _, item := range req.Items {
+		_, err := t.InsertData(sessionId, item)
+		res.Results = append(res.Results, batchResult(item.Path, err))
+	}
+	return res, nil
+}
+
+// UpdateMany patches the matching documents on the client, guarded by the versions that were read
+func (t *txClient) UpdateMany(sessionId string, req UpdateManyRequest) (BatchWriteResponse, error) {
+	items, err := t.matchAll(sessionId, req.Scope, req.TenantId, req.CollectionPath, req.Filter, req.Args)
+	if err != nil {
+		return BatchWriteResponse{}, err
+	}
+
+	res := BatchWriteResponse{
+		Results: make([]sdk.BatchResult, 0, len(items)),
+	}
+	for _, item := range items {
+		for field, value := range req.Patch {
+			setField(item.Data, field, value)
+		}
+
+		cfg := req.Cfg
+		cfg.VersionEquals = item.Version
+		_, err = t.UpdateData(sessionId, UpdateDataRequest{
+			Scope:         req.Scope,
+			TenantId:      req.TenantId,
+			Path:          item.Path,
+			Item:          item.Data,
+			SchemaVersion: item.SchemaVersion,
+			Cfg:           cfg,
+		})
+		res.Results = append(res.Results, batchResult(item.Path, err))
+	}
+	return res, nil
+}
+
+func (t *txClient) DeleteMany(sessionId string, req DeleteManyRequest) (BatchWriteResponse, error) {
+	items, err := t.matchAll(sessionId, req.Scope, req.TenantId, req.CollectionPath, req.Filter, req.Args)
+	if err != nil {
+		return BatchWriteResponse{}, err
+	}
+
+	res := BatchWriteResponse{
+		Results: make([]sdk.BatchResult, 0, len(items)),
+	}
+	for _, item := range items {
+		cfg := req.Cfg
+		cfg.VersionEquals = item.Version
+		err = t.DeleteData(sessionId, DeleteDataRequest{
+			Scope:    req.Scope,
+			TenantId: req.TenantId,
+			Path:     item.Path,
+			Cfg:      cfg,
+		})
+		res.Results = append(res.Results, batchResult(item.Path, err))
+	}
+	return res, nil
+}
+
+// matchAll returns the documents matching the filter as seen in the transaction. They are all
+// read before any is written, so the writes do not move the pages of the query.
+func (t *txClient) matchAll(sessionId string, scope sdk.DataScope, tenantId string, collectionPath string, filter string, args []interface{}) ([]GetDataResponse, error) {
+	req := QueryDataRequest{
+		Scope:          scope,
+		TenantId:       tenantId,
+		CollectionPath: collectionPath,
+		Filter:         filter,
+		Args:           args,
+	}
+
+	var items []GetDataResponse
+	err := queryAll(context.Background(), t, sessionId, req, func(item GetDataResponse) bool {
+		items = append(items, item)
+		return true
+	})
+	return items, err
+}
+
+func (t *txClient) commit(sessionId string) error {
+	if len(t.writes) == 0 {
+		return nil
+	}
+
+	return t.ServiceClient.CommitTransaction(sessionId, CommitTransactionRequest{
+		Reads:  t.reads,
+		Writes: t.writes,
+	})
+}
@@ -0,0 +1,284 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cloudimpl/polycode-runtime/go/sdk"
+)
+
+func TestTransaction_RepeatedWrites(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Put": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				_, err := ctx.Db().Get().ServiceCollection("items").InsertOne(input.Name, &testItem{Name: input.Name, Count: input.Count})
+				return nil, err
+			},
+			"Bump": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				err := ctx.Db().Get().Transaction(func(tx sdk.DataStore) error {
+					doc, err := tx.ServiceCollection("items").GetOne(input.Name)
+					if err != nil {
+						return err
+					}
+
+					var item testItem
+					err = doc.Unmarshal(&item)
+					if err != nil {
+						return err
+					}
+
+					for i := 0; i < 2; i++ {
+						item.Count++
+						err = doc.Update(&item)
+						if err != nil {
+							return err
+						}
+					}
+
+					for i := 0; i < 2; i++ {
+						err = doc.Patch([]sdk.PatchOp{sdk.Increment("count", 1)})
+						if err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				doc, err := ctx.Db().Get().ServiceCollection("items").GetOne(input.Name)
+				if err != nil {
+					return nil, err
+				}
+
+				var item testItem
+				err = doc.Unmarshal(&item)
+				return []int64{int64(item.Count), doc.Version()}, err
+			},
+		},
+	})
+
+	evt := runService(client, "store", "Put", testInput{Name: "a", Count: 1})
+	if evt.IsError {
+		t.Fatalf("put failed: %s", evt.Error.Error())
+	}
+
+	var out []int64
+	mustOutput(t, runService(client, "store", "Bump", testInput{Name: "a"}), &out)
+	if out[0] != 5 || out[1] != 5 {
+		t.Fatalf("expected count 5 at version 5, got %v", out)
+	}
+}
+
+func TestTransaction_QueriesSeeTheirWrites(t *testing.T) {
+	// names returns the names of the documents matching condition in count order
+	names := func(ctx sdk.ServiceContext, items sdk.Collection, condition sdk.Condition) ([]string, error) {
+		docs, err := items.Query().Where(condition).OrderBy("count", sdk.SortAsc).GetAll(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for _, doc := range docs {
+			var item testItem
+			err = doc.Unmarshal(&item)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, item.Name)
+		}
+		return names, nil
+	}
+
+	client := newTestClient(t, &testService{
+		name: "store",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Seed": seedHandler,
+			"Write": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				var found [][]string
+				err := ctx.Db().Get().Transaction(func(tx sdk.DataStore) error {
+					items := tx.ServiceCollection("items")
+					_, err := items.InsertOne("item-new", &testItem{Name: "item-new", Count: 3})
+					if err != nil {
+						return err
+					}
+
+					doc, err := items.GetOne("item-001")
+					if err != nil {
+						return err
+					}
+					err = doc.Update(&testItem{Name: "item-001", Count: 10})
+					if err != nil {
+						return err
+					}
+
+					doc, err = items.GetOne("item-002")
+					if err != nil {
+						return err
+					}
+					err = doc.Delete()
+					if err != nil {
+						return err
+					}
+
+					matches, err := names(ctx, items, sdk.F("count").Gte(2))
+					if err != nil {
+						return err
+					}
+					found = append(found, matches)
+
+					results, err := items.InsertMany([]sdk.InsertItem{{Id: "item-new", Item: &testItem{Name: "item-new"}}})
+					if err != nil {
+						return err
+					} else if len(results) != 1 || !results[0].IsError {
+						return fmt.Errorf("expected inserting a written document to fail, got %+v", results)
+					}
+
+					_, err = items.UpdateMany("", nil, map[string]interface{}{"count": "many"})
+					var validationErr sdk.ValidationError
+					if !errors.As(err, &validationErr) {
+						return fmt.Errorf("expected an invalid patch to fail validation, got %v", err)
+					}
+
+					results, err = items.DeleteMany("count >= ?", []interface{}{4})
+					if err != nil {
+						return err
+					} else if len(results) != 2 || results[0].IsError || results[1].IsError {
+						return fmt.Errorf("expected two documents deleted, got %+v", results)
+					}
+
+					matches, err = names(ctx, items, sdk.F("count").Gte(0))
+					if err != nil {
+						return err
+					}
+					found = append(found, matches)
+					return nil
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				matches, err := names(ctx, ctx.Db().Get().ServiceCollection("items"), sdk.F("count").Gte(0))
+				return append(found, matches), err
+			},
+		},
+	})
+
+	err := GetModelRegistry("store").Register("items", &testItem{})
+	if err != nil {
+		t.Fatalf("failed to register model: %s", err.Error())
+	}
+	startTestApp(t, client)
+
+	mustRun(t, client, "store", "Seed", testInput{Name: "items", Count: 5})
+
+	var found [][]string
+	mustOutput(t, runService(client, "store", "Write", testInput{}), &found)
+	if fmt.Sprint(found) != "[[item-003 item-new item-004 item-001] [item-000 item-003 item-new] [item-000 item-003 item-new]]" {
+		t.Fatalf("unexpected documents seen in and after the transaction %v", found)
+	}
+}
+
+func TestTransaction_ConflictsRollBackParentAndChildWrites(t *testing.T) {
+	client := newTestClient(t, &testService{
+		name: "shop",
+		handlers: map[string]func(ctx sdk.ServiceContext, input *testInput) (any, error){
+			"Seed": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				_, err := ctx.Db().Get().ServiceCollection("orders").InsertOne("o-1", &testItem{Name: "o-1"})
+				return nil, err
+			},
+			"Changed": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				// the order is changed by another writer after the transaction read it
+				err := ctx.Db().Get().Transaction(func(tx sdk.DataStore) error {
+					order, err := tx.ServiceCollection("orders").GetOne("o-1")
+					if err != nil {
+						return err
+					}
+
+					_, err = order.ChildCollection("lines").InsertOne("l-1", &testItem{Name: "l-1"})
+					if err != nil {
+						return err
+					}
+					err = order.Patch([]sdk.PatchOp{sdk.Increment("count", 1)})
+					if err != nil {
+						return err
+					}
+
+					other, err := ctx.Db().Get().ServiceCollection("orders").GetOne("o-1")
+					if err != nil {
+						return err
+					}
+					return other.Patch([]sdk.PatchOp{sdk.Set("name", "changed")})
+				})
+				if !sdk.IsError(err, sdk.ErrConflict) {
+					return nil, fmt.Errorf("expected a conflict, got %v", err)
+				}
+				return nil, nil
+			},
+			"Created": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				// an order the transaction writes without reading is created by another writer,
+				// the line written before it has to be rolled back
+				err := ctx.Db().Get().Transaction(func(tx sdk.DataStore) error {
+					order, err := tx.ServiceCollection("orders").GetOne("o-1")
+					if err != nil {
+						return err
+					}
+
+					_, err = order.ChildCollection("lines").InsertOne("l-2", &testItem{Name: "l-2"})
+					if err != nil {
+						return err
+					}
+					_, err = tx.ServiceCollection("orders").InsertOne("o-2", &testItem{Name: "o-2"})
+					if err != nil {
+						return err
+					}
+
+					_, err = ctx.Db().Get().ServiceCollection("orders").InsertOne("o-2", &testItem{Name: "other"})
+					return err
+				})
+				if !sdk.IsError(err, sdk.ErrAlreadyExist) {
+					return nil, fmt.Errorf("expected the commit to fail on the existing order, got %v", err)
+				}
+				return nil, nil
+			},
+			"Check": func(ctx sdk.ServiceContext, input *testInput) (any, error) {
+				orders := ctx.Db().Get().ServiceCollection("orders")
+				order, err := orders.GetOne("o-1")
+				if err != nil {
+					return nil, err
+				}
+				var item testItem
+				err = order.Unmarshal(&item)
+				if err != nil {
+					return nil, err
+				}
+
+				lines, err := order.ChildCollection("lines").Query().GetAll(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				created, err := orders.GetOne("o-2")
+				if err != nil {
+					return nil, err
+				}
+				var other testItem
+				err = created.Unmarshal(&other)
+				return fmt.Sprintf("%s %d %d %s", item.Name, item.Count, len(lines), other.Name), err
+			},
+		},
+	})
+
+	mustRun(t, client, "shop", "Seed", testInput{})
+	mustRun(t, client, "shop", "Changed", testInput{})
+	mustRun(t, client, "shop", "Created", testInput{})
+
+	var state string
+	mustOutput(t, runService(client, "shop", "Check", testInput{}), &state)
+	if state != "changed 0 0 other" {
+		t.Fatalf("expected only the writes outside the transactions to be kept, got %s", state)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -49,6 +50,24 @@ func ErrorToServiceComplete(err sdk.Error, stacktraceStr string) ServiceComplete
 	}
 }
 
+// ErrorToSdkError returns err as an sdk.Error, wrapping errors of other types as internal errors.
+func ErrorToSdkError(err error) sdk.Error {
+	switch e := err.(type) {
+	case sdk.Error:
+		return e
+	case *sdk.Error:
+		return *e
+	default:
+		return ErrInternal.Wrap(err)
+	}
+}
+
+func CancelToServiceComplete(err sdk.Error) ServiceCompleteEvent {
+	evt := ErrorToServiceComplete(err, "")
+	evt.IsCancelled = true
+	return evt
+}
+
 func ErrorToApiComplete(err sdk.Error) ApiCompleteEvent {
 	return ApiCompleteEvent{
 		Response: sdk.ApiResponse{
@@ -90,6 +109,14 @@ func ExtractServiceDescription(serviceMap map[string]ClientService, modelMap map
 			serviceData.Methods = append(serviceData.Methods, description)
 		}
 
+		for _, collection := range collections {
+			for _, watcher := range collection.Watchers {
+				if !slices.Contains(taskList, watcher) {
+					return nil, fmt.Errorf("collection %s watched by unknown method %s.%s", collection.Name, srvName, watcher)
+				}
+			}
+		}
+
 		services = append(services, serviceData)
 	}
 
@@ -351,3 +378,18 @@ func RetryWithBackoff(
 	}
 	return lastErr
 }
+
+// setField sets a value at a dotted path, creating the intermediate objects.
+func setField(data map[string]interface{}, path string, value any) {
+	parts := strings.Split(path, ".")
+	current := data
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+}